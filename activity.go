@@ -0,0 +1,85 @@
+package main
+
+import (
+	"time"
+)
+
+// prime time of each timezone in EVE time (UTC), the evening hours when
+// most of its players are online
+var timezoneHours = []struct {
+	name        string
+	first, last int
+}{
+	{"EU", 17, 22},
+	{"US", 0, 5},
+	{"AU", 8, 13},
+}
+
+// killmails needed before the timezone is trusted fully, fewer scale the
+// confidence down
+const activityFullSamples = 20
+
+// activityData is when a character is seen on killmails. Heatmap counts the
+// killmails by day of the week, Sunday first, and hour of the day in EVE
+// time. Timezone is EU, US, AU or empty when no prime time stands out, and
+// Confidence from 0 to 1 how sure that is.
+type activityData struct {
+	Heatmap    [7][24]int `json:"heatmap"`
+	Samples    int        `json:"samples"`
+	Timezone   string     `json:"timezone,omitempty"`
+	Confidence float64    `json:"confidence"`
+}
+
+// newActivity builds the activity of a character from ESI killmail
+// timestamps, nil when there are none
+func newActivity(times []string) *activityData {
+	a := activityData{}
+	for _, ts := range times {
+		t, err := time.Parse(time.RFC3339, ts)
+		if err != nil {
+			continue
+		}
+		t = t.UTC()
+		a.Heatmap[t.Weekday()][t.Hour()]++
+		a.Samples++
+	}
+	if a.Samples == 0 {
+		return nil
+	}
+
+	a.Timezone, a.Confidence = a.inferTimezone()
+	return &a
+}
+
+// inferTimezone picks the timezone whose prime time holds the most killmails.
+// The confidence is the share of killmails in that prime time, scaled down
+// when there are few of them.
+func (a *activityData) inferTimezone() (string, float64) {
+	var hours [24]int
+	for _, day := range a.Heatmap {
+		for h, n := range day {
+			hours[h] += n
+		}
+	}
+
+	best, bestCount, tie := "", 0, false
+	for _, tz := range timezoneHours {
+		count := 0
+		for h := tz.first; h <= tz.last; h++ {
+			count += hours[h]
+		}
+		switch {
+		case count > bestCount:
+			best, bestCount, tie = tz.name, count, false
+		case count == bestCount:
+			tie = true
+		}
+	}
+	if bestCount == 0 || tie {
+		return "", 0
+	}
+
+	share := float64(bestCount) / float64(a.Samples)
+	scale := float64(min(a.Samples, activityFullSamples)) / activityFullSamples
+	return best, round2(share * scale)
+}
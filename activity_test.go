@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestNewActivity(t *testing.T) {
+	if a := newActivity(nil); a != nil {
+		t.Fatalf("expected no activity without killmails, got %+v", a)
+	}
+
+	// 2026-10-16 is a Friday
+	times := []string{
+		"2026-10-16T18:10:00Z",
+		"2026-10-16T19:45:00Z",
+		"2026-10-17T21:00:00Z",
+		"2026-10-18T03:00:00Z",
+		"not a time",
+	}
+	a := newActivity(times)
+	if a == nil {
+		t.Fatal("expected activity")
+	}
+	if a.Samples != 4 {
+		t.Errorf("samples = %d, want 4", a.Samples)
+	}
+	if a.Heatmap[5][18] != 1 || a.Heatmap[5][19] != 1 || a.Heatmap[6][21] != 1 || a.Heatmap[0][3] != 1 {
+		t.Errorf("unexpected heatmap %v", a.Heatmap)
+	}
+	if a.Timezone != "EU" {
+		t.Errorf("timezone = %q, want EU", a.Timezone)
+	}
+	// three of four in EU prime time, scaled for 4 of 20 samples
+	if a.Confidence != 0.15 {
+		t.Errorf("confidence = %v, want 0.15", a.Confidence)
+	}
+}
+
+func TestNewActivity_Timezones(t *testing.T) {
+	at := func(hours ...int) []string {
+		var times []string
+		for _, h := range hours {
+			times = append(times, fmt.Sprintf("2026-10-20T%02d:00:00Z", h))
+		}
+		return times
+	}
+
+	tests := []struct {
+		name       string
+		times      []string
+		timezone   string
+		confidence float64
+	}{
+		{"us", at(1, 2, 3, 4), "US", 0.2},
+		{"au", at(9, 10, 12, 20), "AU", 0.15},
+		{"tie", at(1, 18), "", 0},
+		{"off hours", at(7, 15, 16), "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newActivity(tt.times)
+			if a.Timezone != tt.timezone || a.Confidence != tt.confidence {
+				t.Errorf("got %q %v, want %q %v", a.Timezone, a.Confidence, tt.timezone, tt.confidence)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	json "github.com/goccy/go-json"
+	log "github.com/sirupsen/logrus"
+)
+
+// largest request body accepted by the JSON api, more is allowed when the
+// operator raises -max-names
+const (
+	maxAPIBodyBytes = 64 * 1024
+	// room for a quoted, escaped name in a JSON list
+	apiBytesPerName = 64
+)
+
+// apiBodyLimit is the largest JSON api body or live message accepted
+func apiBodyLimit() int64 {
+	return max(maxAPIBodyBytes, int64(maximumNames)*apiBytesPerName)
+}
+
+// body of POST /api/v1/lookups
+type lookupRequest struct {
+	Names   []string      `json:"names"`
+	IDs     []int         `json:"ids"`
+	Options lookupOptions `json:"options"`
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.WithError(err).Warn("failed to write api response")
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, apiError{Error: msg})
+}
+
+// errorStatus maps a lookup failure onto the status code reported to clients
+func errorStatus(err error) int {
+	switch classifyError(err) {
+	case kindNotFound:
+		return http.StatusNotFound
+	case kindInvalid:
+		return http.StatusBadRequest
+	case kindTimeout:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// GET /api/v1/characters/{character}, the path value is either a character
+// id or a name. Lookup options are taken from the query string.
+func apiCharacterHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := withSettings(r.Context(), optionsFromForm(r).settings())
+	key := strings.TrimSpace(r.PathValue("character"))
+
+	var resp *characterResponse
+	if id, err := strconv.Atoi(key); err == nil && id > 0 {
+		resp = fetchCharacterDataByID(ctx, id)
+	} else if reason := validateName(key); reason != "" {
+		writeAPIError(w, http.StatusBadRequest, "invalid character name or id: "+reason)
+		return
+	} else if len(key) > maxCharacterNameLength {
+		writeAPIError(w, http.StatusBadRequest, "invalid character name or id: too long for a character name")
+		return
+	} else {
+		resp = fetchCharacterData(ctx, key)
+	}
+
+	if resp.err != nil {
+		log.WithError(resp.err).WithField("character", key).Warn("api lookup failed")
+		writeAPIError(w, errorStatus(resp.err), resp.err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp.char)
+}
+
+// POST /api/v1/lookups, returns the characters that were found and an error
+// record for every input that was invalid, failed or was left out past the
+// limit. When nothing was found the status code tells why instead.
+func apiLookupsHandler(w http.ResponseWriter, r *http.Request) {
+	var req lookupRequest
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, apiBodyLimit()))
+	if err := dec.Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	settings := req.Options.settings()
+	ctx := withSettings(r.Context(), settings)
+
+	// index counts through names and then ids
+	p := parsePaste(strings.Join(req.Names, "\n"), settings.maxNames)
+	jobs := p.jobs
+	for i, id := range req.IDs {
+		if id > 0 {
+			jobs = append(jobs, lookupJob{index: len(req.Names) + i, input: strconv.Itoa(id), id: id})
+		}
+	}
+
+	if len(jobs) == 0 && len(p.unparsed) == 0 {
+		writeAPIError(w, http.StatusBadRequest, "no names or ids given")
+		return
+	}
+
+	jobs, failures := expandLinks(ctx, jobs, settings.maxNames)
+	for _, l := range p.unparsed {
+		failures = append(failures, unparsedResult(l))
+	}
+	for _, job := range p.truncated {
+		failures = append(failures, truncatedResult(job, settings.maxNames))
+	}
+
+	// corporations and alliances found among the names come back as entity
+	// records beside the characters, failures as error records
+	rows := make([]any, 0, len(jobs)+len(failures))
+	found := 0
+	var lastErr error
+	fail := func(resp lookupResult) {
+		rows = append(rows, resp.errorRecord())
+		// upstream problems win over not found when picking the status, names
+		// past the limit never decide it
+		if classifyError(resp.err) != kindTruncated && (lastErr == nil || classifyError(lastErr) == kindNotFound) {
+			lastErr = resp.err
+		}
+	}
+
+	for _, resp := range failures {
+		fail(resp)
+	}
+
+	results := lookupCharacters(ctx, jobs)
+	if settings.ordered {
+		results = orderResults(ctx, results)
+	}
+
+	for resp := range results {
+		if resp.entity != nil {
+			found++
+			resp.stamp()
+			rows = append(rows, resp.entity)
+			continue
+		}
+		if resp.err != nil {
+			log.WithError(resp.err).Warn("api lookup failed")
+			fail(resp)
+			continue
+		}
+		found++
+		resp.stamp()
+		rows = append(rows, resp.char)
+	}
+
+	if found == 0 && lastErr != nil {
+		writeAPIError(w, errorStatus(lastErr), lastErr.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, rows)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	cache "zgo.at/zcache/v2"
+)
+
+// fakeUpstream serves just enough of ESI and zKillboard for a single
+// character, Mynxee (123), with no kills, her corporation TestCorp (456) and
+// its alliance Test Alliance (789)
+func fakeUpstream(t *testing.T) {
+	t.Helper()
+
+	ccpCache = cache.New[string, any](1*time.Hour, 10*time.Minute)
+	zkillCache = cache.New[string, any](1*time.Hour, 10*time.Minute)
+	killmailCache = cache.New[string, any](1*time.Hour, 10*time.Minute)
+	knownNames = newNameIndex()
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/universe/ids/":
+			var names []string
+			_ = json.NewDecoder(r.Body).Decode(&names)
+			found := map[string][]map[string]any{}
+			// like ESI, names match in any case and come back as spelled in game
+			for _, n := range names {
+				switch strings.ToLower(n) {
+				case "mynxee":
+					found["characters"] = append(found["characters"], map[string]any{"id": 123, "name": "Mynxee"})
+				case "testcorp":
+					found["corporations"] = append(found["corporations"], map[string]any{"id": 456, "name": "TestCorp"})
+				case "test alliance":
+					found["alliances"] = append(found["alliances"], map[string]any{"id": 789, "name": "Test Alliance"})
+				}
+			}
+			_ = json.NewEncoder(w).Encode(found)
+		case "/characters/123/":
+			_ = json.NewEncoder(w).Encode(ccpResponse{Name: "Mynxee", CorpID: 456, Security: 1.5, Birthday: "2000-01-01T00:00:00Z"})
+		case "/characters/500/", "/stats/characterID/500/":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/stats/characterID/123/":
+			_ = json.NewEncoder(w).Encode(zKillResponse{Danger: 10})
+		case "/stats/corporationID/456/":
+			_ = json.NewEncoder(w).Encode(zKillResponse{Danger: 5})
+		case "/characters/123/corporationhistory", "/characters/500/corporationhistory":
+			_ = json.NewEncoder(w).Encode([]map[string]any{{"start_date": "2010-01-01T00:00:00Z"}})
+		case "/corporations/456/":
+			_ = json.NewEncoder(w).Encode(map[string]any{"name": "TestCorp", "ticker": "TEST", "member_count": 42, "alliance_id": 789})
+		case "/alliances/789/":
+			_ = json.NewEncoder(w).Encode(map[string]any{"name": "Test Alliance", "ticker": "TA"})
+		case "/stats/allianceID/789/":
+			_ = json.NewEncoder(w).Encode(map[string]any{"dangerRatio": 20, "info": map[string]any{"memberCount": 1000}})
+		case "/killID/77/":
+			_ = json.NewEncoder(w).Encode([]map[string]any{{"killmail_id": 77, "zkb": map[string]any{"hash": "abc"}}})
+		case "/killmails/77/abc/":
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"killmail_time": "2026-10-16T12:00:00Z",
+				"victim":        map[string]any{"character_id": 123},
+				"attackers": []map[string]any{
+					{"character_id": 0},
+					{"character_id": 500, "final_blow": true},
+				},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(s.Close)
+
+	origZkill := zkillAPIURL
+	origCcp := ccpEsiURL
+	zkillAPIURL = s.URL + "/"
+	ccpEsiURL = s.URL + "/"
+	t.Cleanup(func() { zkillAPIURL = origZkill; ccpEsiURL = origCcp })
+}
+
+func TestAPICharacter(t *testing.T) {
+	fakeUpstream(t)
+	router := newRouter()
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantName   string
+	}{
+		{"by name", "/api/v1/characters/Mynxee", http.StatusOK, "Space Mom"},
+		{"by id", "/api/v1/characters/123", http.StatusOK, "Space Mom"},
+		{"unknown name", "/api/v1/characters/Nobody", http.StatusNotFound, ""},
+		{"unknown id", "/api/v1/characters/404", http.StatusNotFound, ""},
+		{"upstream failure", "/api/v1/characters/500", http.StatusBadGateway, ""},
+		{"any case", "/api/v1/characters/mYNXEE", http.StatusOK, "Space Mom"},
+		{"too short", "/api/v1/characters/ab", http.StatusBadRequest, ""},
+		{"not a name", "/api/v1/characters/Myn_xee", http.StatusBadRequest, ""},
+		{"too long for a character", "/api/v1/characters/Signal%20Cartel%20Exploration%20Division%20Of%20New%20Eden", http.StatusBadRequest, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tc.wantStatus != http.StatusOK {
+				var e apiError
+				if err := json.Unmarshal(rec.Body.Bytes(), &e); err != nil || e.Error == "" {
+					t.Fatalf("expected error body, got %q", rec.Body.String())
+				}
+				return
+			}
+
+			var cd characterData
+			if err := json.Unmarshal(rec.Body.Bytes(), &cd); err != nil {
+				t.Fatalf("bad body: %v", err)
+			}
+			if cd.Name != tc.wantName || cd.CharacterID != 123 || cd.CorpName != "TestCorp" {
+				t.Fatalf("unexpected character %+v", cd)
+			}
+		})
+	}
+}
+
+func TestAPILookups(t *testing.T) {
+	fakeUpstream(t)
+	router := newRouter()
+
+	post := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/lookups", bytes.NewBufferString(body))
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// rows are told apart by _meta, characters have none
+	byMeta := func(rec *httptest.ResponseRecorder) map[any][]map[string]any {
+		t.Helper()
+		var rows []map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &rows); err != nil {
+			t.Fatalf("bad body %q: %v", rec.Body.String(), err)
+		}
+		m := map[any][]map[string]any{}
+		for _, r := range rows {
+			m[r["_meta"]] = append(m[r["_meta"]], r)
+		}
+		return m
+	}
+
+	rec := post(`{"names":["Mynxee","Nobody"],"ids":[123]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rows := byMeta(rec)
+	if len(rows[nil]) != 2 {
+		t.Fatalf("expected 2 characters, got %d", len(rows[nil]))
+	}
+	if errs := rows[eventError]; len(errs) != 1 || errs[0]["input"] != "Nobody" || errs[0]["kind"] != string(kindNotFound) {
+		t.Fatalf("expected Nobody as not found, got %v", errs)
+	}
+
+	rec = post(`{"names":["Mynxee","Nobody","TestCorp"],"options":{"limit":1}}`)
+	rows = byMeta(rec)
+	if rec.Code != http.StatusOK || len(rows[nil]) != 1 {
+		t.Fatalf("expected limit to keep 1 character, got %d (%d)", len(rows[nil]), rec.Code)
+	}
+	errs := rows[eventError]
+	if len(errs) != 2 || errs[0]["kind"] != string(kindTruncated) || errs[1]["kind"] != string(kindTruncated) ||
+		errs[0]["input"] != "Nobody" || errs[1]["input"] != "TestCorp" {
+		t.Fatalf("expected the names past the limit as truncated, got %v", errs)
+	}
+
+	// names that aren't valid are reported, and are a bad request on their own
+	rec = post(`{"names":["Mynxee","x@@y"]}`)
+	if errs := byMeta(rec)[eventError]; rec.Code != http.StatusOK || len(errs) != 1 ||
+		errs[0]["kind"] != string(kindInvalid) || errs[0]["input"] != "x@@y" || errs[0]["index"] != 1.0 {
+		t.Fatalf("expected x@@y as invalid, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec = post(`{"names":["x@@y"]}`); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "not allowed") {
+		t.Fatalf("expected 400 for only invalid names, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// corporations and alliances are found too, not reported missing
+	rec = post(`{"names":["TestCorp","Nobody"]}`)
+	rows = byMeta(rec)
+	if corps := rows[entityCorporation]; rec.Code != http.StatusOK || len(corps) != 1 || corps[0]["name"] != "TestCorp" {
+		t.Fatalf("expected the corporation record, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if rec = post(`{"names":["Nobody"]}`); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 when nothing is found, got %d", rec.Code)
+	}
+	if rec = post(`{"ids":[500]}`); rec.Code != http.StatusBadGateway {
+		t.Fatalf("expected 502 on upstream failure, got %d", rec.Code)
+	}
+	if rec = post(`{"names":[]}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an empty lookup, got %d", rec.Code)
+	}
+	if rec = post(`not json`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a malformed body, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+
+	json "github.com/goccy/go-json"
+	log "github.com/sirupsen/logrus"
+	cache "zgo.at/zcache/v2"
+)
+
+// associates of each kind returned for a character
+const topAssociates = 5
+
+// associate is a character, corporation or alliance seen on the same kills
+// as the character looked up, LastSeen is the ESI timestamp of the latest
+type associate struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Count    int    `json:"count"`
+	LastSeen string `json:"last_seen"`
+}
+
+// associatesData are the most frequent associates of a character, most
+// kills together first
+type associatesData struct {
+	Characters   []associate `json:"characters"`
+	Corporations []associate `json:"corporations"`
+	Alliances    []associate `json:"alliances"`
+}
+
+// coAttackers tallies who flies with a character, counting each kill once
+type coAttackers struct {
+	characters   map[int]*associate
+	corporations map[int]*associate
+	alliances    map[int]*associate
+}
+
+func newCoAttackers() *coAttackers {
+	return &coAttackers{
+		characters:   make(map[int]*associate),
+		corporations: make(map[int]*associate),
+		alliances:    make(map[int]*associate),
+	}
+}
+
+// add counts the other pilots on a kill made by id. Their corporations and
+// alliances count too, unless they are the character's own, NPCs are left
+// out altogether.
+func (c *coAttackers) add(km *killMail, id int) {
+	var self zKillCharInfo
+	for _, a := range km.Attackers {
+		if a.CharacterID == id {
+			self = a
+			break
+		}
+	}
+
+	seen := make(map[*associate]bool)
+	count := func(tally map[int]*associate, other int) {
+		if other == 0 {
+			return
+		}
+		as, ok := tally[other]
+		if !ok {
+			as = &associate{ID: other}
+			tally[other] = as
+		}
+		if seen[as] {
+			return
+		}
+		seen[as] = true
+		as.Count++
+		as.LastSeen = max(as.LastSeen, km.Time)
+	}
+
+	for _, a := range km.Attackers {
+		if a.CharacterID == 0 || a.CharacterID == id {
+			continue
+		}
+		count(c.characters, a.CharacterID)
+		if a.CorporationID != self.CorporationID {
+			count(c.corporations, a.CorporationID)
+		}
+		if a.AllianceID != self.AllianceID {
+			count(c.alliances, a.AllianceID)
+		}
+	}
+}
+
+// top returns the associates seen most often, names resolved in one batch.
+// Names that can't be resolved are left empty.
+func (c *coAttackers) top(ctx context.Context) *associatesData {
+	ad := associatesData{
+		Characters:   topOf(c.characters),
+		Corporations: topOf(c.corporations),
+		Alliances:    topOf(c.alliances),
+	}
+	if len(ad.Characters) == 0 && len(ad.Corporations) == 0 && len(ad.Alliances) == 0 {
+		return nil
+	}
+
+	var ids []int
+	for _, list := range [][]associate{ad.Characters, ad.Corporations, ad.Alliances} {
+		for _, as := range list {
+			ids = append(ids, as.ID)
+		}
+	}
+
+	names, err := fetchNames(ctx, ids)
+	if err != nil {
+		log.WithError(err).Warn("failed to resolve associates")
+	}
+	for _, list := range [][]associate{ad.Characters, ad.Corporations, ad.Alliances} {
+		for i := range list {
+			list[i].Name = names[list[i].ID]
+		}
+	}
+
+	return &ad
+}
+
+func topOf(tally map[int]*associate) []associate {
+	list := make([]associate, 0, len(tally))
+	for _, as := range tally {
+		list = append(list, *as)
+	}
+	slices.SortFunc(list, func(a, b associate) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(b.LastSeen, a.LastSeen), cmp.Compare(a.ID, b.ID))
+	})
+	return list[:min(len(list), topAssociates)]
+}
+
+// fetchNames resolves character, corporation and alliance ids with a single
+// call to universe/names/ for those not seen before. Resolved names are
+// remembered like those from universe/ids/, so they can be looked up and
+// suggested too.
+func fetchNames(ctx context.Context, ids []int) (map[int]string, error) {
+	names := make(map[int]string, len(ids))
+
+	var missing []int
+	for _, id := range ids {
+		if name, found := ccpCache.Get(fmt.Sprint("idname:", id)); found {
+			names[id] = name.(string)
+		} else if !slices.Contains(missing, id) {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return names, nil
+	}
+
+	js, err := json.Marshal(missing)
+	if err != nil {
+		return names, err
+	}
+
+	jsonPayload, err := ccpPost(ctx,
+		"universe/names/",
+		map[string]string{"datasource": "tranquility"},
+		bytes.NewBuffer(js))
+	if err != nil {
+		return names, err
+	}
+
+	type nameEntry struct {
+		ID       int    `json:"id"`
+		Name     string `json:"name"`
+		Category string `json:"category"`
+	}
+
+	var entries []nameEntry
+
+	if err := json.Unmarshal(jsonPayload, &entries); err != nil {
+		return names, err
+	}
+
+	var resolved characterList
+	for _, e := range entries {
+		names[e.ID] = e.Name
+		ccpCache.SetWithExpire(fmt.Sprint("idname:", e.ID), e.Name, cache.NoExpiration)
+
+		entry := idEntry{ID: e.ID, Name: e.Name}
+		switch e.Category {
+		case entityCharacter:
+			resolved.Characters = append(resolved.Characters, entry)
+		case entityCorporation:
+			resolved.Corporations = append(resolved.Corporations, entry)
+		case entityAlliance:
+			resolved.Alliances = append(resolved.Alliances, entry)
+		}
+	}
+	cacheIDs(resolved)
+
+	return names, nil
+}
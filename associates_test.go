@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	cache "zgo.at/zcache/v2"
+)
+
+func TestCoAttackers(t *testing.T) {
+	self := zKillCharInfo{CharacterID: 1, CorporationID: 10, AllianceID: 100}
+	c := newCoAttackers()
+	c.add(&killMail{Time: "2026-10-01T00:00:00Z", Attackers: []zKillCharInfo{
+		self,
+		{CharacterID: 2, CorporationID: 10, AllianceID: 100},
+		{CharacterID: 3, CorporationID: 20, AllianceID: 200},
+		// an NPC
+		{CorporationID: 1000125},
+	}}, 1)
+	c.add(&killMail{Time: "2026-10-02T00:00:00Z", Attackers: []zKillCharInfo{
+		self,
+		{CharacterID: 3, CorporationID: 20, AllianceID: 200},
+		{CharacterID: 4, CorporationID: 20, AllianceID: 200},
+	}}, 1)
+
+	wantChars := []associate{
+		{ID: 3, Count: 2, LastSeen: "2026-10-02T00:00:00Z"},
+		{ID: 4, Count: 1, LastSeen: "2026-10-02T00:00:00Z"},
+		{ID: 2, Count: 1, LastSeen: "2026-10-01T00:00:00Z"},
+	}
+	if got := topOf(c.characters); !slices.Equal(got, wantChars) {
+		t.Errorf("characters = %+v, want %+v", got, wantChars)
+	}
+	// the character's own corporation and alliance are left out, and two
+	// pilots from one corporation on a kill count once
+	wantCorps := []associate{{ID: 20, Count: 2, LastSeen: "2026-10-02T00:00:00Z"}}
+	if got := topOf(c.corporations); !slices.Equal(got, wantCorps) {
+		t.Errorf("corporations = %+v, want %+v", got, wantCorps)
+	}
+	wantAlliances := []associate{{ID: 200, Count: 2, LastSeen: "2026-10-02T00:00:00Z"}}
+	if got := topOf(c.alliances); !slices.Equal(got, wantAlliances) {
+		t.Errorf("alliances = %+v, want %+v", got, wantAlliances)
+	}
+}
+
+func TestCoAttackers_TopResolvesNames(t *testing.T) {
+	ccpCache = cache.New[string, any](1*time.Hour, 10*time.Minute)
+	knownNames = newNameIndex()
+
+	calls := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/universe/names/" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		calls++
+		var ids []int
+		_ = json.NewDecoder(r.Body).Decode(&ids)
+		slices.Sort(ids)
+		if !slices.Equal(ids, []int{3, 20, 200}) {
+			t.Errorf("resolved %v, want [3 20 200]", ids)
+		}
+		_ = json.NewEncoder(w).Encode([]map[string]any{
+			{"id": 3, "name": "Wingman", "category": "character"},
+			{"id": 20, "name": "Hunters", "category": "corporation"},
+			{"id": 200, "name": "Hunting Alliance", "category": "alliance"},
+		})
+	}))
+	defer s.Close()
+
+	origCcp := ccpEsiURL
+	ccpEsiURL = s.URL + "/"
+	defer func() { ccpEsiURL = origCcp }()
+
+	c := newCoAttackers()
+	c.add(&killMail{Time: "2026-10-01T00:00:00Z", Attackers: []zKillCharInfo{
+		{CharacterID: 1, CorporationID: 10},
+		{CharacterID: 3, CorporationID: 20, AllianceID: 200},
+	}}, 1)
+
+	for range 2 {
+		ad := c.top(context.Background())
+		if ad == nil {
+			t.Fatal("expected associates")
+		}
+		if ad.Characters[0].Name != "Wingman" || ad.Corporations[0].Name != "Hunters" || ad.Alliances[0].Name != "Hunting Alliance" {
+			t.Errorf("unexpected names %+v", ad)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("universe/names/ called %d times, want 1", calls)
+	}
+
+	// resolved names can be looked up and suggested
+	if kind, id, ok := lookupEntityID("hunters"); !ok || kind != entityCorporation || id != 20 {
+		t.Errorf("lookupEntityID = %q %d %v", kind, id, ok)
+	}
+	if got := knownNames.suggest("wing", 1); len(got) != 1 || got[0].ID != 3 {
+		t.Errorf("suggest = %+v", got)
+	}
+}
+
+func TestCoAttackers_None(t *testing.T) {
+	c := newCoAttackers()
+	c.add(&killMail{Attackers: []zKillCharInfo{{CharacterID: 1}, {CorporationID: 1000125}}}, 1)
+	if ad := c.top(context.Background()); ad != nil {
+		t.Errorf("expected no associates, got %+v", ad)
+	}
+}
@@ -3,8 +3,9 @@ package main
 import (
 	"bytes"
 	"context"
-
 	"fmt"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
@@ -18,6 +19,9 @@ var (
 	zkillAPIURL = "https://zkillboard.com/api/"
 )
 
+// ESI takes at most this many names in one call to universe/ids/
+const esiIDsChunk = 500
+
 var (
 	ccpCache   = cache.New[string, any](1*time.Hour, 10*time.Minute)
 	zkillCache = cache.New[string, any](1*time.Hour, 10*time.Minute)
@@ -33,16 +37,42 @@ func (c characterData) String() string {
 func fetchCharacterData(ctx context.Context, name string) *characterResponse {
 	cd := characterData{Name: name}
 
-	id, err := fetchCharacterID(ctx, name)
+	entry, err := resolveCharacter(ctx, name)
+	progressFrom(ctx).finish(phaseIDs)
 	if err != nil {
-		return &characterResponse{&cd, fmt.Errorf("'%s' not found", name)}
+		return &characterResponse{&cd, newLookupError(name, 0, err)}
 	}
 
+	// ESI matches names in any case, its spelling is the right one
+	cd.Name = entry.Name
+	cd.CharacterID = entry.ID
+
+	return cd.fetchDetails(ctx, true)
+}
+
+func fetchCharacterDataByID(ctx context.Context, id int) *characterResponse {
+	cd := characterData{CharacterID: id}
+
+	progressFrom(ctx).finish(phaseIDs)
+
+	return cd.fetchDetails(ctx, false)
+}
+
+// fetchDetails fills in everything but the name and id, the name is taken
+// from the CCP record when the caller only knew the id. Unless universe/ids
+// already said so, the CCP record has to show the id is a character before
+// zKillboard is asked about it.
+func (cd characterData) fetchDetails(ctx context.Context, isCharacter bool) *characterResponse {
 	cd.ZkillUsed = true
 
-	cd.CharacterID = id
+	settings := settingsFrom(ctx)
+	cd.AnalyzeKills = settings.analyzeKills
 
-	cd.AnalyzeKills = analyzeKills
+	progress := progressFrom(ctx)
+	progress.expect(phaseCCP)
+	if cd.ZkillUsed {
+		progress.expect(phaseZkill)
+	}
 
 	ch := make(chan *characterResponse, 3)
 	var wg sync.WaitGroup
@@ -55,9 +85,17 @@ func fetchCharacterData(ctx context.Context, name string) *characterResponse {
 		}(f, id)
 	}
 
-	fetcher(fetchCCPRecord, cd.CharacterID)
+	if isCharacter {
+		fetcher(progress.track(phaseCCP, fetchCCPRecord), cd.CharacterID)
+	} else {
+		r := progress.track(phaseCCP, fetchCCPRecord)(ctx, cd.CharacterID)
+		if r.err != nil {
+			return &characterResponse{&cd, newLookupError(cd.Name, cd.CharacterID, r.err)}
+		}
+		mergo.Merge(&cd, r.char)
+	}
 	if cd.ZkillUsed {
-		fetcher(fetchZKillRecord, cd.CharacterID)
+		fetcher(progress.track(phaseZkill, fetchZKillRecord), cd.CharacterID)
 	}
 	fetcher(fetchCorpStartDate, cd.CharacterID)
 
@@ -65,10 +103,10 @@ func fetchCharacterData(ctx context.Context, name string) *characterResponse {
 	close(ch)
 
 	if err := cd.handleMerges(ch); err != nil {
-		return &characterResponse{&cd, err}
+		return &characterResponse{&cd, newLookupError(cd.Name, cd.CharacterID, err)}
 	}
 
-	ch = make(chan *characterResponse, 6)
+	ch = make(chan *characterResponse, 8)
 
 	if cd.ZkillUsed {
 		fetcher(fetchCorpDanger, cd.CorpID)
@@ -80,16 +118,24 @@ func fetchCharacterData(ctx context.Context, name string) *characterResponse {
 		fetcher(fetchLastKillActivity, cd.CharacterID)
 	}
 
-	if analyzeKills && cd.Kills != 0 {
-		fetcher(fetchKillHistory, cd.CharacterID)
+	if settings.analyzeKills && cd.Kills != 0 {
+		progress.expect(phaseKills)
+		fetcher(progress.track(phaseKills, fetchKillHistory), cd.CharacterID)
 		fetcher(fetchRecentKillHistory, cd.CharacterID)
 	}
+	if settings.analyzeKills && cd.Losses != 0 {
+		fetcher(fetchLossHistory, cd.CharacterID)
+		fetcher(fetchCynoEvidence, cd.CharacterID)
+	}
 
 	wg.Wait()
 	close(ch)
 
 	if err := cd.handleMerges(ch); err != nil {
-		return &characterResponse{&cd, err}
+		return &characterResponse{&cd, newLookupError(cd.Name, cd.CharacterID, err)}
+	}
+	if cd.history != nil {
+		cd.history.apply(ctx, &cd)
 	}
 
 	if cd.FavoriteShipID != 0 {
@@ -101,11 +147,13 @@ func fetchCharacterData(ctx context.Context, name string) *characterResponse {
 		close(ch)
 
 		if err := cd.handleMerges(ch); err != nil {
-			return &characterResponse{&cd, err}
+			return &characterResponse{&cd, newLookupError(cd.Name, cd.CharacterID, err)}
 		}
 	}
 
-	if n, ok := nicknames[name]; ok {
+	cd.Threat = computeThreat(&cd)
+
+	if n, ok := nicknames[cd.Name]; ok {
 		cd.Name = n
 	}
 
@@ -117,6 +165,8 @@ func (c *characterData) handleMerges(ch chan *characterResponse) error {
 		if r.err != nil {
 			return r.err
 		}
+		// mergo leaves unexported fields alone
+		c.history = c.history.join(r.char.history)
 		mergo.Merge(c, r.char)
 	}
 	return nil
@@ -136,7 +186,12 @@ func fetchCCPRecord(ctx context.Context, id int) *characterResponse {
 		return &characterResponse{&cd, err}
 	}
 
+	// characters looked up by id are worth suggesting too
+	knownNames.add(entityCharacter, idEntry{ID: id, Name: cr.Name})
+
+	cd.Name = cr.Name
 	cd.Age = secondsToTimeString(secondsSince(cr.Birthday))
+	cd.Birthday = cr.Birthday
 	cd.CorpID = cr.CorpID
 	cd.Security = cr.Security
 	cd.IsNpcCorp = cd.CorpID < 2000000
@@ -169,48 +224,64 @@ func fetchZKillRecord(ctx context.Context, id int) *characterResponse {
 	return &characterResponse{&cd, nil}
 }
 
+// the caches hold characters, corporations and alliances side by side, so
+// their keys say which kind the id is
+func characterKey(id int) string   { return fmt.Sprint("character:", id) }
+func corporationKey(id int) string { return fmt.Sprint("corporation:", id) }
+func allianceKey(id int) string    { return fmt.Sprint("alliance:", id) }
+
 func fetchCharacterJSON(ctx context.Context, id int) (string, error) {
-	ids := fmt.Sprint(id)
+	key := characterKey(id)
 
-	rec, found := ccpCache.Get(ids)
-	if found {
-		return rec.(string), nil
+	if rec, found := ccpCache.Get(key); found {
+		if s, ok := rec.(string); ok {
+			return s, nil
+		}
 	}
 
-	jsonPayload, err := ccpGet(ctx, "characters/"+ids+"/", nil)
+	jsonPayload, err := ccpGet(ctx, fmt.Sprintf("characters/%d/", id), nil)
 	if err != nil {
 		return "", err
 	}
 
-	ccpCache.Set(ids, string(jsonPayload))
+	ccpCache.Set(key, string(jsonPayload))
 	return string(jsonPayload), nil
 }
 
 func fetchZKillJSON(ctx context.Context, id int) (string, error) {
-	ids := fmt.Sprint(id)
+	key := characterKey(id)
 
-	rec, found := zkillCache.Get(ids)
-	if found {
-		return rec.(string), nil
+	if rec, found := zkillCache.Get(key); found {
+		if s, ok := rec.(string); ok {
+			return s, nil
+		}
 	}
 
-	jsonPayload, err := zkillGet(ctx, "stats/characterID/"+ids+"/")
+	jsonPayload, err := zkillGet(ctx, fmt.Sprintf("stats/characterID/%d/", id))
 	if err != nil {
 		return "", err
 	}
 
-	zkillCache.Set(ids, string(jsonPayload))
+	zkillCache.Set(key, string(jsonPayload))
 	return string(jsonPayload), nil
 }
 
+// nameKey is the cache key of a name, names are matched without regard to
+// case like ESI does
+func nameKey(name string) string {
+	return "name:" + strings.ToLower(name)
+}
+
 func loadCharacterIds(ctx context.Context, names []string) (bool, error) {
 	findNames := []string{}
+	asked := make(map[string]bool)
 
 	for _, name := range names {
-		if len(name) == 0 {
+		if len(name) == 0 || asked[nameKey(name)] {
 			continue
 		}
-		_, found := ccpCache.Get(name)
+		asked[nameKey(name)] = true
+		_, found := ccpCache.Get(nameKey(name))
 		if !found {
 			findNames = append(findNames, name)
 		}
@@ -221,46 +292,68 @@ func loadCharacterIds(ctx context.Context, names []string) (bool, error) {
 		return true, nil
 	}
 
-	js, err := json.Marshal(findNames)
-	if err != nil {
-		return false, fmt.Errorf("error marshaling names")
+	// a failed chunk leaves its names to fetchCharacterID, the rest still count
+	found := false
+	var lastErr error
+	for chunk := range slices.Chunk(findNames, esiIDsChunk) {
+		entries, err := postIDs(ctx, chunk)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if !entries.empty() {
+			found = true
+			cacheIDs(entries)
+		}
 	}
 
-	jsonPayload, err := ccpPost(ctx,
-		"universe/ids/",
-		map[string]string{"datasource": "tranquility"},
-		bytes.NewBuffer(js))
-	if err != nil {
-		return false, err
+	if lastErr != nil {
+		return found, lastErr
+	}
+	if !found {
+		return false, fmt.Errorf("no entries found")
 	}
 
-	var entries characterList
+	return true, nil
+}
 
-	if err := json.Unmarshal(jsonPayload, &entries); err != nil {
-		return false, err
-	}
+// postIDs resolves at most esiIDsChunk names with universe/ids/
+func postIDs(ctx context.Context, names []string) (characterList, error) {
+	var entries characterList
 
-	if len(entries.Characters) == 0 {
-		return false, fmt.Errorf("no entries found")
+	js, err := json.Marshal(names)
+	if err != nil {
+		return entries, fmt.Errorf("error marshaling names")
 	}
 
-	for _, entry := range entries.Characters {
-		ccpCache.SetWithExpire(entry.Name, entry.ID, cache.NoExpiration)
+	jsonPayload, err := ccpPost(ctx,
+		"universe/ids/",
+		map[string]string{"datasource": "tranquility"},
+		bytes.NewBuffer(js))
+	if err != nil {
+		return entries, err
 	}
 
-	return true, nil
+	err = json.Unmarshal(jsonPayload, &entries)
+	return entries, err
 }
 
 func fetchCharacterID(ctx context.Context, name string) (int, error) {
-	id, found := ccpCache.Get(name)
+	entry, err := resolveCharacter(ctx, name)
+	return entry.ID, err
+}
+
+// resolveCharacter finds the id and the ESI spelling of a character name
+func resolveCharacter(ctx context.Context, name string) (idEntry, error) {
+	cached, found := ccpCache.Get(nameKey(name))
 	if found {
-		return id.(int), nil
+		return cached.(idEntry), nil
 	}
 
 	nameList := []string{name}
 	js, err := json.Marshal(nameList)
 	if err != nil {
-		return 0, fmt.Errorf("error marshaling %s", name)
+		return idEntry{}, fmt.Errorf("error marshaling %s", name)
 	}
 
 	jsonPayload, err := ccpPost(ctx,
@@ -268,33 +361,36 @@ func fetchCharacterID(ctx context.Context, name string) (int, error) {
 		map[string]string{"datasource": "tranquility"},
 		bytes.NewBuffer(js))
 	if err != nil {
-		return 0, err
+		return idEntry{}, err
 	}
 
 	var entries characterList
 
 	if err := json.Unmarshal(jsonPayload, &entries); err != nil {
 		fmt.Println("error = ", err)
-		return 0, err
+		return idEntry{}, err
 	}
 
+	// corporations and alliances are remembered for lookupEntityID
+	cacheIDs(entries)
+
 	if len(entries.Characters) == 0 {
-		return 0, fmt.Errorf("not found %s", name)
+		return idEntry{}, fmt.Errorf("%w %s", errNotFound, name)
 	}
 
-	cid := 0
-	cid = entries.Characters[0].ID
-
-	ccpCache.SetWithExpire(name, cid, cache.NoExpiration)
-	return cid, nil
+	entry := entries.Characters[0]
+	ccpCache.SetWithExpire(nameKey(name), entry, cache.NoExpiration)
+	return entry, nil
 }
 
 func fetchCorporationName(ctx context.Context, id int) *characterResponse {
 	ids := fmt.Sprint(id)
+	key := corporationKey(id) + ":name"
 
-	name, found := ccpCache.Get(ids)
-	if found {
-		return &characterResponse{&characterData{CorpName: name.(string)}, nil}
+	if name, found := ccpCache.Get(key); found {
+		if s, ok := name.(string); ok {
+			return &characterResponse{&characterData{CorpName: s}, nil}
+		}
 	}
 
 	cd := characterData{CorpName: ""}
@@ -315,7 +411,7 @@ func fetchCorporationName(ctx context.Context, id int) *characterResponse {
 	}
 
 	cd.CorpName = entry.CorporationName
-	ccpCache.SetWithExpire(ids, cd.CorpName, cache.NoExpiration)
+	ccpCache.SetWithExpire(key, cd.CorpName, cache.NoExpiration)
 
 	return &characterResponse{&cd, nil}
 }
@@ -326,10 +422,12 @@ func fetchAllianceName(ctx context.Context, id int) *characterResponse {
 	}
 
 	ids := fmt.Sprint(id)
+	key := allianceKey(id) + ":name"
 
-	name, found := ccpCache.Get(ids)
-	if found {
-		return &characterResponse{&characterData{AllianceName: name.(string)}, nil}
+	if name, found := ccpCache.Get(key); found {
+		if s, ok := name.(string); ok {
+			return &characterResponse{&characterData{AllianceName: s}, nil}
+		}
 	}
 
 	cd := characterData{AllianceName: ""}
@@ -350,7 +448,7 @@ func fetchAllianceName(ctx context.Context, id int) *characterResponse {
 	}
 
 	cd.AllianceName = entry.AllianceName
-	ccpCache.SetWithExpire(ids, cd.AllianceName, cache.NoExpiration)
+	ccpCache.SetWithExpire(key, cd.AllianceName, cache.NoExpiration)
 
 	return &characterResponse{&cd, nil}
 }
@@ -380,6 +478,7 @@ func fetchCorpStartDate(ctx context.Context, id int) *characterResponse {
 	}
 
 	cd.CorpAge = secondsToTimeString(secondsSince(entries[0].StartDate))
+	cd.CorpJoined = entries[0].StartDate
 
 	return &characterResponse{&cd, nil}
 }
@@ -432,10 +531,12 @@ func fetchItemName(ctx context.Context, id int) *characterResponse {
 
 func fetchCorpDanger(ctx context.Context, id int) *characterResponse {
 	ids := fmt.Sprint(id)
+	key := corporationKey(id)
 
-	danger, found := zkillCache.Get(ids)
-	if found {
-		return &characterResponse{&characterData{CorpDanger: danger.(int)}, nil}
+	if danger, found := zkillCache.Get(key); found {
+		if d, ok := danger.(int); ok {
+			return &characterResponse{&characterData{CorpDanger: d}, nil}
+		}
 	}
 
 	cd := characterData{CorpDanger: 0}
@@ -452,7 +553,7 @@ func fetchCorpDanger(ctx context.Context, id int) *characterResponse {
 	}
 
 	cd.CorpDanger = z.Danger
-	zkillCache.Set(ids, cd.CorpDanger)
+	zkillCache.Set(key, cd.CorpDanger)
 
 	return &characterResponse{&cd, nil}
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -134,11 +135,15 @@ func TestFetchCharacterData_WithKills(t *testing.T) {
 
 	origZkill := zkillAPIURL
 	origCcp := ccpEsiURL
-	oldAnalyze := analyzeKills
+	oldAnalyze, oldAllow := analyzeKills, allowKills
 	zkillAPIURL = s.URL + "/"
 	ccpEsiURL = s.URL + "/"
-	analyzeKills = true
-	defer func() { zkillAPIURL = origZkill; ccpEsiURL = origCcp; analyzeKills = oldAnalyze }()
+	analyzeKills, allowKills = true, true
+	defer func() {
+		zkillAPIURL = origZkill
+		ccpEsiURL = origCcp
+		analyzeKills, allowKills = oldAnalyze, oldAllow
+	}()
 
 	r := fetchCharacterData(context.Background(), "Pilot")
 	if r.err != nil {
@@ -152,6 +157,75 @@ func TestFetchCharacterData_WithKills(t *testing.T) {
 	}
 }
 
+func TestFetchCharacterData_OnlyLosses(t *testing.T) {
+	ccpCache = cache.New[string, any](1*time.Hour, 10*time.Minute)
+	zkillCache = cache.New[string, any](1*time.Hour, 10*time.Minute)
+	killmailCache = cache.New[string, any](1*time.Hour, 10*time.Minute)
+
+	// a cyno alt, lost a Badger in Jita and never killed anything
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/universe/ids/":
+			_ = json.NewEncoder(w).Encode(map[string]any{"characters": []map[string]any{{"id": 998, "name": "Alt"}}})
+		case "/characters/998/":
+			_ = json.NewEncoder(w).Encode(ccpResponse{Name: "Alt", CorpID: 10, Birthday: "2005-01-01T00:00:00Z"})
+		case "/stats/characterID/998/":
+			_ = json.NewEncoder(w).Encode(zKillResponse{Losses: 1})
+		case "/stats/corporationID/10/":
+			_ = json.NewEncoder(w).Encode(zKillResponse{})
+		case "/characters/998/corporationhistory":
+			_ = json.NewEncoder(w).Encode([]map[string]any{{"start_date": "2012-05-01T00:00:00Z"}})
+		case "/corporations/10/":
+			_ = json.NewEncoder(w).Encode(map[string]any{"name": "AltCorp"})
+		case "/characterID/998/", "/losses/characterID/998/":
+			_ = json.NewEncoder(w).Encode([]zKillMail{{ID: 4, Info: zKillMailInfo{Hash: "h4"}}})
+		case "/killmails/4/h4/":
+			_ = json.NewEncoder(w).Encode(killMail{Time: "2020-01-01T00:00:00Z", SystemID: 30000142, Victim: zKillCharInfo{CharacterID: 998, ShipTypeID: 648}})
+		case "/universe/types/648/":
+			_ = json.NewEncoder(w).Encode(map[string]any{"name": "Badger", "group_id": 28})
+		case "/universe/groups/28/":
+			_ = json.NewEncoder(w).Encode(map[string]any{"name": "Hauler", "category_id": 6})
+		case "/universe/categories/6/":
+			_ = json.NewEncoder(w).Encode(map[string]any{"name": "Ship"})
+		case "/universe/systems/30000142/":
+			_ = json.NewEncoder(w).Encode(map[string]any{"name": "Jita", "security_status": 0.9, "constellation_id": 20000020})
+		case "/universe/constellations/20000020/":
+			_ = json.NewEncoder(w).Encode(map[string]any{"name": "Kimotoro", "region_id": 10000002})
+		case "/universe/regions/10000002/":
+			_ = json.NewEncoder(w).Encode(map[string]any{"name": "The Forge"})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+
+	origZkill := zkillAPIURL
+	origCcp := ccpEsiURL
+	oldAnalyze, oldAllow := analyzeKills, allowKills
+	zkillAPIURL = s.URL + "/"
+	ccpEsiURL = s.URL + "/"
+	analyzeKills, allowKills = true, true
+	defer func() {
+		zkillAPIURL = origZkill
+		ccpEsiURL = origCcp
+		analyzeKills, allowKills = oldAnalyze, oldAllow
+	}()
+
+	r := fetchCharacterData(context.Background(), "Alt")
+	if r.err != nil {
+		t.Fatalf("unexpected err: %v", r.err)
+	}
+	if r.char.Locations == nil || r.char.Locations.Systems[0].Name != "Jita" {
+		t.Errorf("expected the loss to place Alt in Jita, got %+v", r.char.Locations)
+	}
+	if r.char.Activity == nil || r.char.Activity.Samples != 1 {
+		t.Errorf("activity = %+v, want 1 sample", r.char.Activity)
+	}
+	if r.char.ShipClasses == nil || len(r.char.ShipClasses.Losses) != 1 || r.char.ShipClasses.Losses[0] != (classCount{classHauler, 1}) {
+		t.Errorf("ship classes = %+v, want one hauler lost", r.char.ShipClasses)
+	}
+}
+
 func TestFetchCharacterID_TableDriven(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -270,3 +344,88 @@ func TestFetchCharacterData_Timeout(t *testing.T) {
 		t.Fatalf("expected timeout error, got nil")
 	}
 }
+
+func TestLoadCharacterIds_Chunks(t *testing.T) {
+	ccpCache = cache.New[string, any](1*time.Hour, 10*time.Minute)
+
+	var calls []int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var names []string
+		_ = json.NewDecoder(r.Body).Decode(&names)
+		calls = append(calls, len(names))
+
+		found := make([]map[string]any, 0, len(names))
+		for _, n := range names {
+			var id int
+			_, _ = fmt.Sscanf(n, "Pilot %d", &id)
+			found = append(found, map[string]any{"id": id, "name": n})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"characters": found})
+	}))
+	defer s.Close()
+
+	orig := ccpEsiURL
+	ccpEsiURL = s.URL + "/"
+	defer func() { ccpEsiURL = orig }()
+
+	names := make([]string, 0, 1200)
+	for i := 1; i <= 1200; i++ {
+		names = append(names, fmt.Sprint("Pilot ", i))
+	}
+
+	if ok, err := loadCharacterIds(context.Background(), names); !ok || err != nil {
+		t.Fatalf("loadCharacterIds = %v, %v", ok, err)
+	}
+	if len(calls) != 3 || calls[0] != esiIDsChunk || calls[2] != 200 {
+		t.Fatalf("expected chunks of %d, got %v", esiIDsChunk, calls)
+	}
+	if id, err := fetchCharacterID(context.Background(), "pilot 1200"); err != nil || id != 1200 {
+		t.Fatalf("expected the last chunk to be cached, got %d %v", id, err)
+	}
+}
+
+func TestFetchCharacterDataByID_NotACharacter(t *testing.T) {
+	ccpCache = cache.New[string, any](1*time.Hour, 10*time.Minute)
+	zkillCache = cache.New[string, any](1*time.Hour, 10*time.Minute)
+
+	statsAsked := false
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/stats/characterID/456/":
+			// zKillboard answers for any id, corporations too
+			statsAsked = true
+			_ = json.NewEncoder(w).Encode(zKillResponse{Danger: 50})
+		case "/stats/corporationID/456/":
+			_ = json.NewEncoder(w).Encode(zKillResponse{Danger: 5})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+
+	origZkill := zkillAPIURL
+	origCcp := ccpEsiURL
+	zkillAPIURL = s.URL + "/"
+	ccpEsiURL = s.URL + "/"
+	defer func() { zkillAPIURL = origZkill; ccpEsiURL = origCcp }()
+
+	// 456 is a corporation, ESI has no character by that id
+	r := fetchCharacterDataByID(context.Background(), 456)
+	if classifyError(r.err) != kindNotFound {
+		t.Fatalf("expected not found, got %v", r.err)
+	}
+	if statsAsked {
+		t.Error("expected no zKillboard stats for an id that isn't a character")
+	}
+
+	// whatever is cached under another kind's key can't be taken for danger
+	zkillCache.Set(characterKey(456), "{}")
+	d := fetchCorpDanger(context.Background(), 456)
+	if d.err != nil || d.char.CorpDanger != 5 {
+		t.Fatalf("expected corporation danger 5, got %+v %v", d.char, d.err)
+	}
+	zkillCache.Set(corporationKey(456), "{}")
+	if d = fetchCorpDanger(context.Background(), 456); d.err != nil || d.char.CorpDanger != 5 {
+		t.Fatalf("expected a bad cache entry to be fetched again, got %+v %v", d.char, d.err)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"slices"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// signs of a cyno pilot on a loss
+const (
+	signCyno           = "cyno"
+	signCovertCyno     = "covert_cyno"
+	signIndustrialCyno = "industrial_cyno"
+	signForceRecon     = "force_recon"
+	signBlackOps       = "black_ops"
+)
+
+// cyno modules by type
+var cynoModules = map[int]string{
+	21096: signCyno,           // Cynosural Field Generator I
+	28646: signCovertCyno,     // Covert Cynosural Field Generator I
+	52694: signIndustrialCyno, // Industrial Cynosural Field Generator
+}
+
+// hulls that fit a covert cyno by group
+var cynoHullGroups = map[int]string{
+	833: signForceRecon, // Force Recon Ship
+	898: signBlackOps,   // Black Ops
+}
+
+// inventory flags of the high slots, where a cyno is fitted
+const (
+	flagHighSlot0 = 27
+	flagHighSlot7 = 34
+)
+
+// cynoEvidence is a loss that gives a character away as a cyno pilot, Date
+// is the ESI timestamp of the kill
+type cynoEvidence struct {
+	KillmailID int      `json:"killmail_id"`
+	Date       string   `json:"date"`
+	ShipTypeID int      `json:"ship_type_id"`
+	Signs      []string `json:"signs"`
+}
+
+// fetchCynoEvidence looks through the recent losses of a character for
+// fitted cynos and the hulls that carry them. The losses are extra detail, a
+// character whose losses can't be fetched is reported without them rather
+// than failing the lookup.
+func fetchCynoEvidence(ctx context.Context, id int) *characterResponse {
+	cd := characterData{}
+
+	losses, err := fetchRecentLosses(ctx, id)
+	if err != nil {
+		log.WithError(err).WithField("id", id).Warn("failed to fetch losses")
+		return &characterResponse{&cd, nil}
+	}
+
+	var evidence []cynoEvidence
+	for _, loss := range losses {
+		signs := cynoSigns(ctx, loss.km)
+		if len(signs) == 0 {
+			continue
+		}
+		evidence = append(evidence, cynoEvidence{
+			KillmailID: loss.id,
+			Date:       loss.km.Time,
+			ShipTypeID: loss.km.Victim.ShipTypeID,
+			Signs:      signs,
+		})
+	}
+
+	cd.CynoPilot = len(evidence) != 0
+	cd.CynoEvidence = evidence
+
+	return &characterResponse{&cd, nil}
+}
+
+// cynoSigns lists what on a loss points to a cyno pilot, the hull first
+func cynoSigns(ctx context.Context, km *killMail) []string {
+	var signs []string
+
+	if km.Victim.ShipTypeID != 0 {
+		ti, err := fetchTypeInfo(ctx, km.Victim.ShipTypeID)
+		if err != nil {
+			log.WithError(err).WithField("type", km.Victim.ShipTypeID).Debug("failed to fetch hull")
+		} else if sign, ok := cynoHullGroups[ti.GroupID]; ok {
+			signs = append(signs, sign)
+		}
+	}
+
+	for _, item := range km.Victim.Items {
+		if item.Flag < flagHighSlot0 || item.Flag > flagHighSlot7 {
+			continue
+		}
+		if sign, ok := cynoModules[item.TypeID]; ok && !slices.Contains(signs, sign) {
+			signs = append(signs, sign)
+		}
+	}
+
+	return signs
+}
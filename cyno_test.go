@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	cache "zgo.at/zcache/v2"
+)
+
+func TestFetchCynoEvidence(t *testing.T) {
+	ccpCache = cache.New[string, any](1*time.Hour, 10*time.Minute)
+	zkillCache = cache.New[string, any](1*time.Hour, 10*time.Minute)
+	killmailCache = cache.New[string, any](1*time.Hour, 10*time.Minute)
+
+	// hulls are known so no static data is fetched
+	ccpCache.Set("typeinfo:11969", typeInfo{ID: 11969, Name: "Arazu", GroupID: 833})
+	ccpCache.Set("typeinfo:648", typeInfo{ID: 648, Name: "Badger", GroupID: 28})
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/losses/characterID/5/":
+			_ = json.NewEncoder(w).Encode([]zKillMail{
+				{ID: 3, Info: zKillMailInfo{Hash: "h3"}},
+				{ID: 2, Info: zKillMailInfo{Hash: "h2"}},
+				{ID: 1, Info: zKillMailInfo{Hash: "h1"}},
+			})
+		case "/killmails/1/h1/":
+			_ = json.NewEncoder(w).Encode(killMail{Time: "2026-10-01T00:00:00Z", Victim: zKillCharInfo{CharacterID: 5, ShipTypeID: 11969}})
+		case "/killmails/2/h2/":
+			// a cyno fitted and a covert cyno in the cargo
+			_ = json.NewEncoder(w).Encode(killMail{Time: "2026-10-02T00:00:00Z", Victim: zKillCharInfo{
+				CharacterID: 5, ShipTypeID: 648,
+				Items: []killItem{{TypeID: 21096, Flag: 27}, {TypeID: 28646, Flag: 5}},
+			}})
+		case "/killmails/3/h3/":
+			_ = json.NewEncoder(w).Encode(killMail{Time: "2026-10-03T00:00:00Z", Victim: zKillCharInfo{CharacterID: 5, ShipTypeID: 648}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+
+	origZkill := zkillAPIURL
+	origCcp := ccpEsiURL
+	zkillAPIURL = s.URL + "/"
+	ccpEsiURL = s.URL + "/"
+	defer func() { zkillAPIURL = origZkill; ccpEsiURL = origCcp }()
+
+	r := fetchCynoEvidence(context.Background(), 5)
+	if r.err != nil {
+		t.Fatalf("unexpected err: %v", r.err)
+	}
+	if !r.char.CynoPilot {
+		t.Fatal("expected a cyno pilot")
+	}
+
+	want := []cynoEvidence{
+		{KillmailID: 2, Date: "2026-10-02T00:00:00Z", ShipTypeID: 648, Signs: []string{signCyno}},
+		{KillmailID: 1, Date: "2026-10-01T00:00:00Z", ShipTypeID: 11969, Signs: []string{signForceRecon}},
+	}
+	if len(r.char.CynoEvidence) != len(want) {
+		t.Fatalf("evidence = %+v, want %+v", r.char.CynoEvidence, want)
+	}
+	for i, e := range r.char.CynoEvidence {
+		if e.KillmailID != want[i].KillmailID || e.Date != want[i].Date ||
+			e.ShipTypeID != want[i].ShipTypeID || !slices.Equal(e.Signs, want[i].Signs) {
+			t.Errorf("evidence[%d] = %+v, want %+v", i, e, want[i])
+		}
+	}
+}
+
+func TestFetchCynoEvidence_NoLosses(t *testing.T) {
+	zkillCache = cache.New[string, any](1*time.Hour, 10*time.Minute)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer s.Close()
+
+	origZkill := zkillAPIURL
+	zkillAPIURL = s.URL + "/"
+	defer func() { zkillAPIURL = origZkill }()
+
+	// losses that can't be fetched don't fail the character
+	r := fetchCynoEvidence(context.Background(), 6)
+	if r.err != nil {
+		t.Fatalf("unexpected err: %v", r.err)
+	}
+	if r.char.CynoPilot || r.char.CynoEvidence != nil {
+		t.Fatalf("expected no evidence, got %+v", r.char)
+	}
+}
@@ -28,6 +28,64 @@ type characterData struct {
 	FavoriteShipName    string  `json:"favorite_ship_name"`
 	ZkillUsed           bool    `json:"zkill_used"`
 	AnalyzeKills        bool    `json:"analyze_kills"`
+	// machine readable versions of age, corp_age and last_kill, ESI timestamps
+	Birthday     string `json:"birthday,omitempty"`
+	CorpJoined   string `json:"corp_joined,omitempty"`
+	LastKillAt   string `json:"last_kill_at,omitempty"`
+	LastKillKind string `json:"last_kill_kind,omitempty"`
+	// position in the lookup: line of the paste, the line as pasted and the
+	// order the record was streamed in
+	Index int    `json:"index"`
+	Input string `json:"input,omitempty"`
+	Seq   int    `json:"seq,omitempty"`
+	// where the character is in a pasted fleet
+	Fleet *fleetMember `json:"fleet,omitempty"`
+	// what the character did on a pasted kill
+	Kill *killInvolvement `json:"kill,omitempty"`
+	// how dangerous the character looks and why
+	Threat *threatScore `json:"threat,omitempty"`
+	// recent losses with a cyno fitted or in a cyno hull, newest first
+	CynoPilot    bool           `json:"cyno_pilot"`
+	CynoEvidence []cynoEvidence `json:"cyno_evidence,omitempty"`
+	// kills in covert hulls and losses with a covert ops cloak fitted, only
+	// with kill analysis
+	CloakyHunter    bool           `json:"cloaky_hunter"`
+	CovertKillShare int            `json:"covert_kill_share"`
+	HunterExample   *hunterExample `json:"hunter_example,omitempty"`
+	// when the character is seen on killmails, only with kill analysis
+	Activity *activityData `json:"activity,omitempty"`
+	// who else is on the character's kills, only with kill analysis
+	Associates *associatesData `json:"associates,omitempty"`
+	// where the character is seen on killmails, only with kill analysis
+	Locations *locationData `json:"locations,omitempty"`
+	// kills and losses by ship class, only with kill analysis
+	ShipClasses *shipClassData `json:"ship_classes,omitempty"`
+	// what the kill and loss analysis saw, until fetchDetails joins it
+	history *killmailHistory
+}
+
+// fleetMember is a row of the fleet window
+type fleetMember struct {
+	System   string `json:"system"`
+	Ship     string `json:"ship"`
+	Role     string `json:"role"`
+	Position string `json:"position,omitempty"`
+}
+
+// entityData is the row sent for a corporation or alliance, Kind is
+// "corporation" or "alliance"
+type entityData struct {
+	Kind         string `json:"_meta"`
+	ID           int    `json:"id"`
+	Name         string `json:"name"`
+	Ticker       string `json:"ticker"`
+	Danger       int    `json:"danger"`
+	MemberCount  int    `json:"member_count"`
+	AllianceID   int    `json:"alliance_id,omitempty"`
+	AllianceName string `json:"alliance_name,omitempty"`
+	Index        int    `json:"index"`
+	Input        string `json:"input,omitempty"`
+	Seq          int    `json:"seq,omitempty"`
 }
 
 type characterResponse struct {
@@ -50,7 +108,13 @@ type idEntry struct {
 }
 
 type characterList struct {
-	Characters []idEntry `json:"characters"`
+	Characters   []idEntry `json:"characters"`
+	Corporations []idEntry `json:"corporations"`
+	Alliances    []idEntry `json:"alliances"`
+}
+
+func (l characterList) empty() bool {
+	return len(l.Characters) == 0 && len(l.Corporations) == 0 && len(l.Alliances) == 0
 }
 
 type zKillResponse struct {
@@ -58,4 +122,8 @@ type zKillResponse struct {
 	Gang   int `json:"gangRatio"`
 	Kills  int `json:"shipsDestroyed"`
 	Losses int `json:"shipsLost"`
+	// only filled in for corporation and alliance stats
+	Info struct {
+		MemberCount int `json:"memberCount"`
+	} `json:"info"`
 }
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// a d-scan of a busy grid runs to a few thousand lines
+	maxDscanBytes = 256 * 1024
+	// but holds far fewer kinds of thing, every new one can cost three ESI
+	// calls to resolve
+	maxDscanTypes = 500
+	kmPerAU       = 149_597_870.7
+)
+
+// distance bands of a scan, the last one is open ended
+var dscanBands = []struct {
+	name  string
+	maxKm float64
+}{
+	{"grid", 10_000},
+	{"near", kmPerAU},
+	{"system", math.Inf(1)},
+}
+
+// one line of the d-scan window: type id, name, type name and distance
+type dscanEntry struct {
+	typeID   int
+	typeName string
+	// distance in km, ok is false for "-" when the object is out of range
+	km float64
+	ok bool
+}
+
+type dscanCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type dscanClass struct {
+	Class string       `json:"class"`
+	Count int          `json:"count"`
+	Types []dscanCount `json:"types"`
+}
+
+type dscanBand struct {
+	Band  string  `json:"band"`
+	MaxKm float64 `json:"max_km,omitempty"`
+	Total int     `json:"total"`
+	Ships int     `json:"ships"`
+}
+
+// dscanReport is the summary returned by /dscan
+type dscanReport struct {
+	// every object on the scan
+	Total int `json:"total"`
+	// ships other than capsules, about the number of pilots in space
+	Hulls    int `json:"hulls"`
+	Capsules int `json:"capsules"`
+	// ship classes, largest first
+	Classes     []dscanClass `json:"classes"`
+	Categories  []dscanCount `json:"categories"`
+	HasCapitals bool         `json:"has_capitals"`
+	Capitals    []dscanCount `json:"capitals"`
+	Structures  []dscanCount `json:"structures"`
+	// mobile warp disruptors and interdiction probes
+	Bubbles    int            `json:"bubbles"`
+	Distance   []dscanBand    `json:"distance"`
+	Unparsed   []unparsedLine `json:"unparsed"`
+	Unresolved []int          `json:"unresolved"`
+}
+
+// parseDistance reads "1,234 km", "800 m" or "4.2 AU". Grouping separators
+// depend on the client language, km and m are always whole numbers.
+func parseDistance(s string) (float64, bool) {
+	s = strings.ToLower(strings.TrimSpace(strings.ReplaceAll(s, "\u00a0", " ")))
+
+	var num string
+	var scale float64
+	switch {
+	case strings.HasSuffix(s, "au"):
+		num, scale = strings.ReplaceAll(strings.TrimSuffix(s, "au"), ",", "."), kmPerAU
+	case strings.HasSuffix(s, "km"):
+		num, scale = strings.NewReplacer(",", "", ".", "").Replace(strings.TrimSuffix(s, "km")), 1
+	case strings.HasSuffix(s, "m"):
+		num, scale = strings.NewReplacer(",", "", ".", "").Replace(strings.TrimSuffix(s, "m")), 0.001
+	default:
+		return 0, false
+	}
+
+	v, err := strconv.ParseFloat(strings.ReplaceAll(num, " ", ""), 64)
+	if err != nil {
+		return 0, false
+	}
+	return v * scale, true
+}
+
+// parseDscan reads the tab separated copy of the d-scan window, lines with
+// a type past the first maxDscanTypes distinct ones are left unparsed
+func parseDscan(text string) ([]dscanEntry, []unparsedLine) {
+	var entries []dscanEntry
+	unparsed := make([]unparsedLine, 0)
+	types := make(map[int]bool)
+
+	for i, line := range newlineRegex.Split(text, -1) {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) < 3 {
+			unparsed = append(unparsed, unparsedLine{Index: i, Input: line, Reason: "not a d-scan line"})
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimSpace(fields[0]))
+		if err != nil || id <= 0 {
+			unparsed = append(unparsed, unparsedLine{Index: i, Input: line, Reason: "no type id"})
+			continue
+		}
+		if !types[id] && len(types) >= maxDscanTypes {
+			unparsed = append(unparsed, unparsedLine{Index: i, Input: line, Reason: "too many different types"})
+			continue
+		}
+		types[id] = true
+
+		e := dscanEntry{typeID: id, typeName: strings.TrimSpace(fields[2])}
+		if len(fields) > 3 {
+			e.km, e.ok = parseDistance(fields[3])
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, unparsed
+}
+
+// resolveTypes looks up every distinct type on the scan, returning what could
+// be resolved and the last error seen
+func resolveTypes(ctx context.Context, entries []dscanEntry) (map[int]typeInfo, error) {
+	types := make(map[int]typeInfo)
+	var lastErr error
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxWorkers)
+
+	seen := make(map[int]bool)
+	for _, e := range entries {
+		if seen[e.typeID] {
+			continue
+		}
+		seen[e.typeID] = true
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(id int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			ti, err := fetchTypeInfo(ctx, id)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				log.WithError(err).WithField("type", id).Debug("type lookup failed")
+				lastErr = err
+				return
+			}
+			types[id] = ti
+		}(e.typeID)
+	}
+	wg.Wait()
+
+	return types, lastErr
+}
+
+// sortedCounts turns a tally into a list, largest first
+func sortedCounts(m map[string]int) []dscanCount {
+	counts := make([]dscanCount, 0, len(m))
+	for name, n := range m {
+		counts = append(counts, dscanCount{Name: name, Count: n})
+	}
+	slices.SortFunc(counts, func(a, b dscanCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Name, b.Name))
+	})
+	return counts
+}
+
+func summarizeDscan(entries []dscanEntry, types map[int]typeInfo) dscanReport {
+	rep := dscanReport{Total: len(entries)}
+
+	classTypes := make(map[string]map[string]int)
+	categories := make(map[string]int)
+	capitals := make(map[string]int)
+	structures := make(map[string]int)
+	bands := make([]dscanBand, len(dscanBands))
+	for i, b := range dscanBands {
+		bands[i].Band = b.name
+		if !math.IsInf(b.maxKm, 1) {
+			bands[i].MaxKm = b.maxKm
+		}
+	}
+	var unknown dscanBand
+	unknown.Band = "unknown"
+	unresolved := make(map[int]bool)
+
+	for _, e := range entries {
+		ti, ok := types[e.typeID]
+		if !ok {
+			unresolved[e.typeID] = true
+			ti = typeInfo{ID: e.typeID, Name: e.typeName, CategoryName: "Unknown"}
+		}
+		isShip := ti.CategoryID == categoryShip
+
+		categories[ti.CategoryName]++
+
+		switch {
+		case isShip && ti.GroupID == groupCapsule:
+			rep.Capsules++
+		case isShip:
+			rep.Hulls++
+			if classTypes[ti.GroupName] == nil {
+				classTypes[ti.GroupName] = make(map[string]int)
+			}
+			classTypes[ti.GroupName][ti.Name]++
+			if capitalGroups[ti.GroupID] {
+				capitals[ti.Name]++
+			}
+		case ti.CategoryID == categoryStructure || ti.CategoryID == categoryStarbase:
+			structures[ti.Name]++
+		case ti.GroupID == groupMobileWarpDisruptor || ti.GroupID == groupInterdictionProbe:
+			rep.Bubbles++
+		}
+
+		band := &unknown
+		if e.ok {
+			for i, b := range dscanBands {
+				if e.km <= b.maxKm {
+					band = &bands[i]
+					break
+				}
+			}
+		}
+		band.Total++
+		if isShip && ti.GroupID != groupCapsule {
+			band.Ships++
+		}
+	}
+
+	rep.Classes = make([]dscanClass, 0, len(classTypes))
+	for class, byType := range classTypes {
+		c := dscanClass{Class: class, Types: sortedCounts(byType)}
+		for _, t := range c.Types {
+			c.Count += t.Count
+		}
+		rep.Classes = append(rep.Classes, c)
+	}
+	slices.SortFunc(rep.Classes, func(a, b dscanClass) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Class, b.Class))
+	})
+
+	rep.Categories = sortedCounts(categories)
+	rep.Capitals = sortedCounts(capitals)
+	rep.HasCapitals = len(capitals) > 0
+	rep.Structures = sortedCounts(structures)
+
+	rep.Distance = bands
+	if unknown.Total > 0 {
+		rep.Distance = append(rep.Distance, unknown)
+	}
+
+	rep.Unresolved = make([]int, 0, len(unresolved))
+	for id := range unresolved {
+		rep.Unresolved = append(rep.Unresolved, id)
+	}
+	slices.Sort(rep.Unresolved)
+
+	return rep
+}
+
+// POST /dscan, summarizes the d-scan copy in the scan form field
+func dscanHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxDscanBytes)
+	if err := r.ParseForm(); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid form")
+		return
+	}
+
+	entries, unparsed := parseDscan(r.FormValue("scan"))
+	if len(entries) == 0 {
+		writeAPIError(w, http.StatusBadRequest, "no d-scan lines found")
+		return
+	}
+
+	types, err := resolveTypes(r.Context(), entries)
+	if len(types) == 0 && err != nil {
+		writeAPIError(w, errorStatus(err), err.Error())
+		return
+	}
+
+	rep := summarizeDscan(entries, types)
+	rep.Unparsed = unparsed
+
+	log.WithFields(log.Fields{"objects": rep.Total, "hulls": rep.Hulls}).Info("d-scan summarized")
+	writeJSON(w, http.StatusOK, rep)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cache "zgo.at/zcache/v2"
+)
+
+// fakeStaticData serves types, groups and categories for the d-scan tests and
+// counts the requests made
+func fakeStaticData(t *testing.T) *atomic.Int32 {
+	t.Helper()
+
+	ccpCache = cache.New[string, any](1*time.Hour, 10*time.Minute)
+
+	types := map[int]map[string]any{
+		587:   {"name": "Rifter", "group_id": 25},
+		603:   {"name": "Merlin", "group_id": 25},
+		670:   {"name": "Capsule", "group_id": 29},
+		23757: {"name": "Archon", "group_id": 547},
+		35832: {"name": "Astrahus", "group_id": 1657},
+		12199: {"name": "Mobile Large Warp Disruptor I", "group_id": 361},
+		2488:  {"name": "Warrior I", "group_id": 100},
+	}
+	groups := map[int]map[string]any{
+		25:   {"name": "Frigate", "category_id": 6},
+		29:   {"name": "Capsule", "category_id": 6},
+		547:  {"name": "Carrier", "category_id": 6},
+		1657: {"name": "Citadel", "category_id": 65},
+		361:  {"name": "Mobile Warp Disruptor", "category_id": 22},
+		100:  {"name": "Combat Drone", "category_id": 18},
+	}
+	categories := map[int]string{6: "Ship", 65: "Structure", 22: "Deployable", 18: "Drone"}
+
+	var calls atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		var id int
+		switch {
+		case sscan(r.URL.Path, "/universe/types/%d/", &id) && types[id] != nil:
+			_ = json.NewEncoder(w).Encode(types[id])
+		case sscan(r.URL.Path, "/universe/groups/%d/", &id) && groups[id] != nil:
+			_ = json.NewEncoder(w).Encode(groups[id])
+		case sscan(r.URL.Path, "/universe/categories/%d/", &id) && categories[id] != "":
+			_ = json.NewEncoder(w).Encode(map[string]any{"name": categories[id]})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(s.Close)
+
+	orig := ccpEsiURL
+	ccpEsiURL = s.URL + "/"
+	t.Cleanup(func() { ccpEsiURL = orig })
+
+	return &calls
+}
+
+func sscan(path, format string, id *int) bool {
+	n, err := fmt.Sscanf(path, format, id)
+	return err == nil && n == 1
+}
+
+func TestParseDistance(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   float64
+		wantOK bool
+	}{
+		{"1,234 km", 1234, true},
+		{"1.234 km", 1234, true},
+		{"1 234 km", 1234, true},
+		{"800 m", 0.8, true},
+		{"2.5 AU", 2.5 * kmPerAU, true},
+		{"2,5 AU", 2.5 * kmPerAU, true},
+		{"-", 0, false},
+		{"", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseDistance(tt.in)
+		if ok != tt.wantOK || got != tt.want {
+			t.Errorf("parseDistance(%q) = %v, %v; want %v, %v", tt.in, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestDscan(t *testing.T) {
+	calls := fakeStaticData(t)
+
+	scan := strings.Join([]string{
+		"587\tMynxee's Rifter\tRifter\t2,000 km",
+		"587\tRifter\tRifter\t12,000 km",
+		"603\tMerlin\tMerlin\t3 AU",
+		"670\tCapsule\tCapsule\t1,500 km",
+		"23757\tArchon\tArchon\t-",
+		"35832\tHome\tAstrahus\t5.1 AU",
+		"12199\tBubble\tMobile Large Warp Disruptor I\t900 km",
+		"2488\tWarrior I\tWarrior I\t1,000 km",
+		"99999\tMystery\tSomething New\t1,000 km",
+		"Mynxee",
+	}, "\n")
+
+	form := url.Values{"scan": {scan}}
+	req := httptest.NewRequest(http.MethodPost, "/dscan", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	newRouter().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	var rep dscanReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &rep); err != nil {
+		t.Fatal(err)
+	}
+
+	if rep.Total != 9 || rep.Hulls != 4 || rep.Capsules != 1 || rep.Bubbles != 1 {
+		t.Fatalf("unexpected totals %+v", rep)
+	}
+	if len(rep.Classes) != 2 || rep.Classes[0].Class != "Frigate" || rep.Classes[0].Count != 3 ||
+		rep.Classes[0].Types[0] != (dscanCount{Name: "Rifter", Count: 2}) {
+		t.Fatalf("unexpected classes %+v", rep.Classes)
+	}
+	if !rep.HasCapitals || len(rep.Capitals) != 1 || rep.Capitals[0].Name != "Archon" {
+		t.Fatalf("unexpected capitals %+v", rep.Capitals)
+	}
+	if len(rep.Structures) != 1 || rep.Structures[0].Name != "Astrahus" {
+		t.Fatalf("unexpected structures %+v", rep.Structures)
+	}
+	if len(rep.Unresolved) != 1 || rep.Unresolved[0] != 99999 {
+		t.Fatalf("unexpected unresolved %v", rep.Unresolved)
+	}
+	if len(rep.Unparsed) != 1 || rep.Unparsed[0].Index != 9 {
+		t.Fatalf("unexpected unparsed %v", rep.Unparsed)
+	}
+
+	bands := map[string]dscanBand{}
+	for _, b := range rep.Distance {
+		bands[b.Band] = b
+	}
+	if b := bands["grid"]; b.Total != 5 || b.Ships != 1 {
+		t.Fatalf("unexpected grid band %+v", b)
+	}
+	if b := bands["near"]; b.Total != 1 || b.Ships != 1 {
+		t.Fatalf("unexpected near band %+v", b)
+	}
+	if b := bands["system"]; b.Total != 2 || b.Ships != 1 {
+		t.Fatalf("unexpected system band %+v", b)
+	}
+	if b := bands["unknown"]; b.Total != 1 || b.Ships != 1 {
+		t.Fatalf("unexpected unknown band %+v", b)
+	}
+
+	// static data is cached for good, a second scan only retries the unknown type
+	before := calls.Load()
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/dscan", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	newRouter().ServeHTTP(rec, req)
+	if got := calls.Load() - before; got != 1 {
+		t.Fatalf("expected 1 upstream call on the second scan, got %d", got)
+	}
+	if name, _ := ccpCache.Get("ship:587"); name != "Rifter" {
+		t.Fatalf("expected the type name to be cached for fetchItemName, got %v", name)
+	}
+}
+
+func TestDscan_Empty(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/dscan", strings.NewReader("scan=Mynxee"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	newRouter().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+}
+
+func TestParseDscan_TypeLimit(t *testing.T) {
+	var b strings.Builder
+	for id := 1; id <= maxDscanTypes+2; id++ {
+		fmt.Fprintf(&b, "%d\tThing\tThing Type\t1 km\n", id)
+	}
+	// a type already seen still counts past the limit
+	b.WriteString("1\tThing\tThing Type\t1 km\n")
+
+	entries, unparsed := parseDscan(b.String())
+	if len(entries) != maxDscanTypes+1 {
+		t.Errorf("got %d entries, want %d", len(entries), maxDscanTypes+1)
+	}
+	if len(unparsed) != 2 || unparsed[0].Index != maxDscanTypes || unparsed[0].Reason != "too many different types" {
+		t.Errorf("unexpected unparsed lines %+v", unparsed)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	json "github.com/goccy/go-json"
+	cache "zgo.at/zcache/v2"
+)
+
+// what a pasted name can resolve to, corporations and alliances are sent as
+// records with these as their _meta
+const (
+	entityCharacter   = "character"
+	entityCorporation = "corporation"
+	entityAlliance    = "alliance"
+)
+
+func entityIDKey(kind, name string) string {
+	return kind + "-" + nameKey(name)
+}
+
+// cacheIDs remembers the ids of every character, corporation and alliance in
+// an answer from universe/ids/ and adds the names to knownNames. Names don't
+// change hands, so they are kept for good.
+func cacheIDs(entries characterList) {
+	for _, entry := range entries.Characters {
+		ccpCache.SetWithExpire(nameKey(entry.Name), entry, cache.NoExpiration)
+		knownNames.add(entityCharacter, entry)
+	}
+	for _, entry := range entries.Corporations {
+		ccpCache.SetWithExpire(entityIDKey(entityCorporation, entry.Name), entry.ID, cache.NoExpiration)
+		knownNames.add(entityCorporation, entry)
+	}
+	for _, entry := range entries.Alliances {
+		ccpCache.SetWithExpire(entityIDKey(entityAlliance, entry.Name), entry.ID, cache.NoExpiration)
+		knownNames.add(entityAlliance, entry)
+	}
+}
+
+// lookupEntityID finds a name that universe/ids/ resolved to a corporation or
+// alliance rather than a character, corporations first
+func lookupEntityID(name string) (string, int, bool) {
+	for _, kind := range []string{entityCorporation, entityAlliance} {
+		if id, found := ccpCache.Get(entityIDKey(kind, name)); found {
+			return kind, id.(int), true
+		}
+	}
+	return "", 0, false
+}
+
+// fetchEntity fetches the row of a corporation or alliance
+func fetchEntity(ctx context.Context, kind string, id int) (*entityData, error) {
+	switch kind {
+	case entityCorporation:
+		return fetchCorporationEntity(ctx, id)
+	case entityAlliance:
+		return fetchAllianceEntity(ctx, id)
+	}
+	return nil, fmt.Errorf("unknown entity %q", kind)
+}
+
+// fetchEntityJSON gets the ESI record of a corporation or alliance
+func fetchEntityJSON(ctx context.Context, kind string, id int) ([]byte, error) {
+	key := fmt.Sprintf("%s:%d", kind, id)
+
+	if rec, found := ccpCache.Get(key); found {
+		if b, ok := rec.([]byte); ok {
+			return b, nil
+		}
+	}
+
+	jsonPayload, err := ccpGet(ctx, fmt.Sprintf("%s/%d/", entityPath(kind), id), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ccpCache.Set(key, jsonPayload)
+	return jsonPayload, nil
+}
+
+func entityPath(kind string) string {
+	if kind == entityCorporation {
+		return "corporations"
+	}
+	return "alliances"
+}
+
+func fetchCorporationEntity(ctx context.Context, id int) (*entityData, error) {
+	jsonPayload, err := fetchEntityJSON(ctx, entityCorporation, id)
+	if err != nil {
+		return nil, err
+	}
+
+	type corpEntry struct {
+		Name        string `json:"name"`
+		Ticker      string `json:"ticker"`
+		MemberCount int    `json:"member_count"`
+		AllianceID  int    `json:"alliance_id"`
+	}
+
+	var entry corpEntry
+
+	if err := json.Unmarshal(jsonPayload, &entry); err != nil {
+		return nil, err
+	}
+
+	ed := entityData{
+		Kind:        entityCorporation,
+		ID:          id,
+		Name:        entry.Name,
+		Ticker:      entry.Ticker,
+		MemberCount: entry.MemberCount,
+		AllianceID:  entry.AllianceID,
+	}
+
+	danger := fetchCorpDanger(ctx, id)
+	if danger.err != nil {
+		return nil, danger.err
+	}
+	ed.Danger = danger.char.CorpDanger
+
+	alliance := fetchAllianceName(ctx, entry.AllianceID)
+	if alliance.err != nil {
+		return nil, alliance.err
+	}
+	ed.AllianceName = alliance.char.AllianceName
+
+	return &ed, nil
+}
+
+// fetchAllianceEntity takes the member count from zKillboard, ESI only has
+// it per corporation
+func fetchAllianceEntity(ctx context.Context, id int) (*entityData, error) {
+	jsonPayload, err := fetchEntityJSON(ctx, entityAlliance, id)
+	if err != nil {
+		return nil, err
+	}
+
+	type allianceEntry struct {
+		Name   string `json:"name"`
+		Ticker string `json:"ticker"`
+	}
+
+	var entry allianceEntry
+
+	if err := json.Unmarshal(jsonPayload, &entry); err != nil {
+		return nil, err
+	}
+
+	stats, err := fetchAllianceStats(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entityData{
+		Kind:        entityAlliance,
+		ID:          id,
+		Name:        entry.Name,
+		Ticker:      entry.Ticker,
+		Danger:      stats.Danger,
+		MemberCount: stats.Info.MemberCount,
+	}, nil
+}
+
+func fetchAllianceStats(ctx context.Context, id int) (zKillResponse, error) {
+	key := allianceKey(id)
+
+	if stats, found := zkillCache.Get(key); found {
+		if z, ok := stats.(zKillResponse); ok {
+			return z, nil
+		}
+	}
+
+	var z zKillResponse
+
+	jsonPayload, err := zkillGet(ctx, fmt.Sprintf("stats/allianceID/%d/", id))
+	if err != nil {
+		return z, err
+	}
+
+	if err := json.Unmarshal(jsonPayload, &z); err != nil {
+		return z, err
+	}
+
+	zkillCache.Set(key, z)
+	return z, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestServeData_Entities(t *testing.T) {
+	fakeUpstream(t)
+
+	records := postInfo(t, "TestCorp\nTest Alliance\nNobody\n")
+
+	if len(records) != 5 {
+		t.Fatalf("expected start, 3 results and done, got %v", records)
+	}
+
+	byMeta := map[any]map[string]any{}
+	for _, r := range records[1:4] {
+		byMeta[r["_meta"]] = r
+	}
+
+	corp := byMeta[entityCorporation]
+	if corp == nil || corp["id"] != 456.0 || corp["ticker"] != "TEST" || corp["danger"] != 5.0 ||
+		corp["member_count"] != 42.0 || corp["alliance_name"] != "Test Alliance" || corp["index"] != 0.0 {
+		t.Fatalf("unexpected corporation record %v", corp)
+	}
+	alliance := byMeta[entityAlliance]
+	if alliance == nil || alliance["name"] != "Test Alliance" || alliance["ticker"] != "TA" ||
+		alliance["danger"] != 20.0 || alliance["member_count"] != 1000.0 {
+		t.Fatalf("unexpected alliance record %v", alliance)
+	}
+	if byMeta["error"] == nil || byMeta["error"]["name"] != "Nobody" {
+		t.Fatalf("expected Nobody to still be not found, got %v", records[1:4])
+	}
+
+	done := records[4]
+	if done["sent"] != 2.0 || done["failed"] != 1.0 {
+		t.Fatalf("unexpected done record %v", done)
+	}
+}
+
+func TestServeData_EntityLink(t *testing.T) {
+	fakeUpstream(t)
+
+	records := postInfo(t, "https://zkillboard.com/corporation/456/")
+
+	if len(records) != 3 || records[1]["_meta"] != entityCorporation || records[1]["name"] != "TestCorp" {
+		t.Fatalf("expected a corporation record, got %v", records)
+	}
+}
+
+func TestLookupCharacters_EntityIsNotACharacter(t *testing.T) {
+	fakeUpstream(t)
+
+	// callers that only want characters see a corporation as not found
+	for res := range lookupCharacters(t.Context(), nameJobs([]string{"TestCorp"})) {
+		if res.entity == nil || classifyError(res.err) != kindNotFound {
+			t.Fatalf("expected an entity with a not found error, got %+v %v", res.entity, res.err)
+		}
+	}
+}
+
+func TestLookupJob_EntityLinkFinishesIDs(t *testing.T) {
+	fakeUpstream(t)
+
+	p := newLookupProgress(1)
+	ctx := withProgress(t.Context(), p)
+	job := lookupJob{input: "https://zkillboard.com/corporation/456/", id: 456, entity: entityCorporation}
+	if res := job.lookup(ctx, 0); res.entity == nil {
+		t.Fatalf("expected a corporation, got %v", res.err)
+	}
+
+	// the id needs no resolving, the phase must not be left waiting on it
+	if c := *p.phases[phaseIDs]; c != (phaseCount{Done: 1, Total: 1}) {
+		t.Fatalf("ids phase = %+v, want 1 of 1", c)
+	}
+}
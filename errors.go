@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// errNotFound is matched with errors.Is when a name or id does not exist upstream
+var errNotFound = errors.New("not found")
+
+// the kind of failure reported to clients for a name that could not be looked up
+type errorKind string
+
+const (
+	kindNotFound errorKind = "not_found"
+	kindUpstream errorKind = "upstream"
+	kindTimeout  errorKind = "timeout"
+	// the input was rejected before any lookup
+	kindInvalid   errorKind = "invalid"
+	kindTruncated errorKind = "truncated"
+)
+
+// lookupError is returned by fetchCharacterData when a character can't be
+// looked up, it records which input failed and why
+type lookupError struct {
+	Name string
+	ID   int
+	Kind errorKind
+	Err  error
+}
+
+func (e *lookupError) Error() string {
+	who := e.Name
+	if who == "" {
+		who = fmt.Sprint(e.ID)
+	}
+	if e.Kind == kindNotFound {
+		return fmt.Sprintf("'%s' not found", who)
+	}
+	return fmt.Sprintf("'%s': %v", who, e.Err)
+}
+
+func (e *lookupError) Unwrap() error {
+	return e.Err
+}
+
+func newLookupError(name string, id int, err error) *lookupError {
+	return &lookupError{Name: name, ID: id, Kind: classifyError(err), Err: err}
+}
+
+// classifyError decides which errorKind an error from the fetch functions is
+func classifyError(err error) errorKind {
+	var le *lookupError
+	if errors.As(err, &le) {
+		return le.Kind
+	}
+
+	var ne net.Error
+	switch {
+	case errors.Is(err, errNotFound):
+		return kindNotFound
+	case errors.Is(err, context.DeadlineExceeded):
+		return kindTimeout
+	case errors.As(err, &ne) && ne.Timeout():
+		return kindTimeout
+	default:
+		return kindUpstream
+	}
+}
+
+// errorRecord is the NDJSON record streamed for a failed lookup
+func errorRecord(err error) map[string]any {
+	rec := map[string]any{
+		"_meta":   eventError,
+		"kind":    classifyError(err),
+		"message": err.Error(),
+	}
+
+	var le *lookupError
+	if errors.As(err, &le) {
+		rec["name"] = le.Name
+		if le.ID != 0 {
+			rec["id"] = le.ID
+		}
+	}
+
+	return rec
+}
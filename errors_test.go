@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+type timeoutErr struct{}
+
+func (timeoutErr) Error() string   { return "i/o timeout" }
+func (timeoutErr) Timeout() bool   { return true }
+func (timeoutErr) Temporary() bool { return true }
+
+func TestClassifyError(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want errorKind
+	}{
+		{"not found sentinel", fmt.Errorf("%w X", errNotFound), kindNotFound},
+		{"http 404", &httpError{StatusCode: 404, URL: "u"}, kindNotFound},
+		{"http 500", &httpError{StatusCode: 500, URL: "u"}, kindUpstream},
+		{"deadline", &transportError{URL: "u", Err: context.DeadlineExceeded}, kindTimeout},
+		{"net timeout", &transportError{URL: "u", Err: timeoutErr{}}, kindTimeout},
+		{"other", errors.New("boom"), kindUpstream},
+		{"lookup error keeps kind", &lookupError{Name: "X", Kind: kindTimeout, Err: errors.New("x")}, kindTimeout},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := classifyError(tc.err); got != tc.want {
+				t.Fatalf("classifyError(%v) = %q; want %q", tc.err, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestErrorRecord(t *testing.T) {
+	rec := errorRecord(newLookupError("Nobody", 0, fmt.Errorf("%w Nobody", errNotFound)))
+
+	if rec["_meta"] != "error" || rec["name"] != "Nobody" || rec["kind"] != kindNotFound {
+		t.Fatalf("unexpected record %v", rec)
+	}
+	if rec["message"] != "'Nobody' not found" {
+		t.Fatalf("unexpected message %q", rec["message"])
+	}
+	if _, ok := rec["id"]; ok {
+		t.Fatalf("id should be omitted for name lookups")
+	}
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// exportColumn is one column of an export, numeric columns are written as
+// numbers in spreadsheets
+type exportColumn struct {
+	name    string
+	numeric bool
+	value   func(cd *characterData) string
+}
+
+func textColumn(name string, f func(cd *characterData) string) exportColumn {
+	return exportColumn{name: name, value: f}
+}
+
+func intColumn(name string, f func(cd *characterData) int) exportColumn {
+	return exportColumn{name: name, numeric: true, value: func(cd *characterData) string {
+		return strconv.Itoa(f(cd))
+	}}
+}
+
+func fleetColumn(name string, f func(m *fleetMember) string) exportColumn {
+	return textColumn(name, func(cd *characterData) string {
+		if cd.Fleet == nil {
+			return ""
+		}
+		return f(cd.Fleet)
+	})
+}
+
+func killColumn(name string, f func(k *killInvolvement) string) exportColumn {
+	return textColumn(name, func(cd *characterData) string {
+		if cd.Kill == nil {
+			return ""
+		}
+		return f(cd.Kill)
+	})
+}
+
+func boolColumn(name string, f func(cd *characterData) bool) exportColumn {
+	return exportColumn{name: name, value: func(cd *characterData) string {
+		return strconv.FormatBool(f(cd))
+	}}
+}
+
+// exportColumns are the fields streamed by serveData, in their default order.
+// Ages are exported as the timestamps they were computed from.
+var exportColumns = []exportColumn{
+	intColumn("index", func(cd *characterData) int { return cd.Index }),
+	textColumn("input", func(cd *characterData) string { return cd.Input }),
+	textColumn("name", func(cd *characterData) string { return cd.Name }),
+	intColumn("character_id", func(cd *characterData) int { return cd.CharacterID }),
+	textColumn("birthday", func(cd *characterData) string { return cd.Birthday }),
+	{name: "security", numeric: true, value: func(cd *characterData) string {
+		return strconv.FormatFloat(float64(cd.Security), 'f', 2, 32)
+	}},
+	intColumn("danger", func(cd *characterData) int { return cd.Danger }),
+	intColumn("gang", func(cd *characterData) int { return cd.Gang }),
+	intColumn("kills", func(cd *characterData) int { return cd.Kills }),
+	intColumn("losses", func(cd *characterData) int { return cd.Losses }),
+	boolColumn("has_killboard", func(cd *characterData) bool { return cd.HasKillboard }),
+	textColumn("last_kill_at", func(cd *characterData) string { return cd.LastKillAt }),
+	textColumn("last_kill_kind", func(cd *characterData) string { return cd.LastKillKind }),
+	textColumn("corp_name", func(cd *characterData) string { return cd.CorpName }),
+	intColumn("corp_id", func(cd *characterData) int { return cd.CorpID }),
+	textColumn("corp_joined", func(cd *characterData) string { return cd.CorpJoined }),
+	boolColumn("is_npc_corp", func(cd *characterData) bool { return cd.IsNpcCorp }),
+	intColumn("corp_danger", func(cd *characterData) int { return cd.CorpDanger }),
+	textColumn("alliance_name", func(cd *characterData) string { return cd.AllianceName }),
+	intColumn("alliance_id", func(cd *characterData) int { return cd.AllianceID }),
+	intColumn("recent_kill_total", func(cd *characterData) int { return cd.RecentKillTotal }),
+	intColumn("recent_explorer_total", func(cd *characterData) int { return cd.RecentExplorerTotal }),
+	textColumn("last_kill_time", func(cd *characterData) string { return cd.LastKillTime }),
+	intColumn("kills_last_week", func(cd *characterData) int { return cd.KillsLastWeek }),
+	intColumn("threat", func(cd *characterData) int {
+		if cd.Threat == nil {
+			return 0
+		}
+		return cd.Threat.Score
+	}),
+	boolColumn("cyno_pilot", func(cd *characterData) bool { return cd.CynoPilot }),
+	boolColumn("cloaky_hunter", func(cd *characterData) bool { return cd.CloakyHunter }),
+	intColumn("covert_kill_share", func(cd *characterData) int { return cd.CovertKillShare }),
+	intColumn("favorite_ship_id", func(cd *characterData) int { return cd.FavoriteShipID }),
+	textColumn("favorite_ship_name", func(cd *characterData) string { return cd.FavoriteShipName }),
+	intColumn("favorite_ship_count", func(cd *characterData) int { return cd.FavoriteShipCount }),
+	fleetColumn("fleet_system", func(m *fleetMember) string { return m.System }),
+	fleetColumn("fleet_ship", func(m *fleetMember) string { return m.Ship }),
+	fleetColumn("fleet_role", func(m *fleetMember) string { return m.Role }),
+	fleetColumn("fleet_position", func(m *fleetMember) string { return m.Position }),
+	killColumn("killmail_id", func(k *killInvolvement) string { return strconv.Itoa(k.KillmailID) }),
+	killColumn("kill_role", func(k *killInvolvement) string { return k.Role }),
+}
+
+func exportColumnNames() []string {
+	names := make([]string, len(exportColumns))
+	for i, c := range exportColumns {
+		names[i] = c.name
+	}
+	return names
+}
+
+// selectColumns picks columns by name in the order given, every column when
+// no names are given
+func selectColumns(names []string) ([]exportColumn, error) {
+	if len(names) == 0 {
+		return exportColumns, nil
+	}
+
+	cols := make([]exportColumn, 0, len(names))
+	for _, n := range names {
+		i := slices.IndexFunc(exportColumns, func(c exportColumn) bool { return c.name == n })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown column %q", n)
+		}
+		cols = append(cols, exportColumns[i])
+	}
+	return cols, nil
+}
+
+type exportFormat struct {
+	ext         string
+	contentType string
+	write       func(w io.Writer, cols []exportColumn, chars []*characterData) error
+}
+
+var exportFormats = map[string]exportFormat{
+	"csv": {"csv", "text/csv; charset=utf-8", func(w io.Writer, cols []exportColumn, chars []*characterData) error {
+		return writeDelimited(w, ',', cols, chars)
+	}},
+	"tsv": {"tsv", "text/tab-separated-values; charset=utf-8", func(w io.Writer, cols []exportColumn, chars []*characterData) error {
+		return writeDelimited(w, '\t', cols, chars)
+	}},
+	"xlsx": {"xlsx", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", writeXLSX},
+}
+
+// neutralizeFormula keeps a spreadsheet from running a text cell as a
+// formula. Pasted lines end up in the input column and snapshots are shared,
+// so a cell starting like a formula is prefixed with a quote.
+func neutralizeFormula(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// writeDelimited writes a header row and one row per character
+func writeDelimited(w io.Writer, sep rune, cols []exportColumn, chars []*characterData) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = sep
+
+	row := make([]string, len(cols))
+	for i, c := range cols {
+		row[i] = c.name
+	}
+	if err := cw.Write(row); err != nil {
+		return err
+	}
+
+	for _, cd := range chars {
+		for i, c := range cols {
+			row[i] = c.value(cd)
+			if !c.numeric {
+				row[i] = neutralizeFormula(row[i])
+			}
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// the smallest set of parts Excel, LibreOffice and Google Sheets accept
+var xlsxParts = []struct{ name, body string }{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="Characters" sheetId="1" r:id="rId1"/></sheets>` +
+		`</workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`},
+}
+
+// writeXLSX writes a single sheet workbook, text goes in as inline strings so
+// no shared string table is needed
+func writeXLSX(w io.Writer, cols []exportColumn, chars []*characterData) error {
+	zw := zip.NewWriter(w)
+
+	for _, p := range xlsxParts {
+		f, err := zw.Create(p.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, p.body); err != nil {
+			return err
+		}
+	}
+
+	f, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+	header := make([]string, len(cols))
+	for i, c := range cols {
+		header[i] = c.name
+	}
+	writeXLSXRow(&b, 1, header, nil)
+
+	values := make([]string, len(cols))
+	for r, cd := range chars {
+		for i, c := range cols {
+			values[i] = c.value(cd)
+		}
+		writeXLSXRow(&b, r+2, values, cols)
+	}
+
+	b.WriteString(`</sheetData></worksheet>`)
+	if _, err := io.WriteString(f, b.String()); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// writeXLSXRow writes row r, numbers only for numeric cols, nil cols writes
+// everything as text
+func writeXLSXRow(b *strings.Builder, r int, values []string, cols []exportColumn) {
+	fmt.Fprintf(b, `<row r="%d">`, r)
+	for i, v := range values {
+		ref := xlsxColumnName(i) + strconv.Itoa(r)
+		if cols != nil && cols[i].numeric {
+			fmt.Fprintf(b, `<c r="%s"><v>%s</v></c>`, ref, v)
+			continue
+		}
+		fmt.Fprintf(b, `<c r="%s" t="inlineStr"><is><t>`, ref)
+		_ = xml.EscapeText(b, []byte(v))
+		b.WriteString(`</t></is></c>`)
+	}
+	b.WriteString(`</row>`)
+}
+
+// xlsxColumnName turns a zero based index into A, B, ... Z, AA, AB, ...
+func xlsxColumnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// exportRequest reads format and columns from form or query values, columns
+// may be repeated or comma separated
+func exportRequest(r *http.Request) (exportFormat, []exportColumn, error) {
+	name := strings.ToLower(r.FormValue("format"))
+	if name == "" {
+		name = "csv"
+	}
+	format, ok := exportFormats[name]
+	if !ok {
+		return exportFormat{}, nil, fmt.Errorf("unknown format %q", name)
+	}
+
+	var names []string
+	for _, v := range r.Form["columns"] {
+		for _, n := range strings.Split(v, ",") {
+			if n = strings.TrimSpace(n); n != "" {
+				names = append(names, n)
+			}
+		}
+	}
+
+	cols, err := selectColumns(names)
+	if err != nil {
+		return exportFormat{}, nil, err
+	}
+	return format, cols, nil
+}
+
+func writeExport(w http.ResponseWriter, format exportFormat, cols []exportColumn, chars []*characterData) {
+	filename := "sclh-" + time.Now().UTC().Format("20060102-150405") + "." + format.ext
+
+	w.Header().Set("Content-Type", format.contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	if err := format.write(w, cols, chars); err != nil {
+		log.WithError(err).Warn("export failed")
+	}
+}
+
+// POST /export, looks up the characters form field like serveData and returns
+// the results as a file: format is csv, tsv or xlsx, columns picks the fields
+func exportHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	format, cols, err := exportRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	settings := optionsFromForm(r).settings()
+	ctx := withSettings(r.Context(), settings)
+	jobs := parseInput(r.FormValue("characters"), settings.maxNames)
+	if len(jobs) == 0 {
+		http.Error(w, "no names given", http.StatusBadRequest)
+		return
+	}
+
+	jobs, _ = expandLinks(ctx, jobs, settings.maxNames)
+
+	chars := make([]*characterData, 0, len(jobs))
+	for res := range orderResults(ctx, lookupCharacters(ctx, jobs)) {
+		if res.err != nil {
+			log.WithError(res.err).Warn("export lookup failed")
+			continue
+		}
+		res.stamp()
+		chars = append(chars, res.char)
+	}
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	writeExport(w, format, cols, chars)
+}
+
+// GET /r/{id}/export, the characters of a saved snapshot as a file
+func snapshotExportHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	format, cols, err := exportRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if snapshots == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	id := r.PathValue("id")
+	s, err := snapshots.Load(id)
+	if errors.Is(err, errNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.WithError(err).WithField("snapshot", id).Error("failed to load snapshot")
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	writeExport(w, format, cols, s.Characters)
+}
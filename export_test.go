@@ -0,0 +1,224 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func postExport(t *testing.T, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/export", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	newRouter().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestExport_CSV(t *testing.T) {
+	fakeUpstream(t)
+
+	rec := postExport(t, url.Values{
+		"characters": {"Mynxee\nNobody"},
+		"columns":    {"name,character_id", "birthday", "corp_joined"},
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"name", "character_id", "birthday", "corp_joined"},
+		{"Space Mom", "123", "2000-01-01T00:00:00Z", "2010-01-01T00:00:00Z"},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("expected %v, got %v", want, rows)
+	}
+	for i := range want {
+		if strings.Join(rows[i], "|") != strings.Join(want[i], "|") {
+			t.Fatalf("row %d: expected %v, got %v", i, want[i], rows[i])
+		}
+	}
+}
+
+func TestExport_TSV(t *testing.T) {
+	fakeUpstream(t)
+
+	rec := postExport(t, url.Values{"characters": {"Mynxee"}, "format": {"tsv"}, "columns": {"name,corp_name"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if got := rec.Body.String(); got != "name\tcorp_name\nSpace Mom\tTestCorp\n" {
+		t.Fatalf("unexpected tsv %q", got)
+	}
+}
+
+func TestExport_BadRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		form url.Values
+	}{
+		{"unknown format", url.Values{"characters": {"Mynxee"}, "format": {"pdf"}}},
+		{"unknown column", url.Values{"characters": {"Mynxee"}, "columns": {"name,password"}}},
+		{"no names", url.Values{"characters": {""}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := postExport(t, tt.form); rec.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d", rec.Code)
+			}
+		})
+	}
+}
+
+func TestWriteXLSX(t *testing.T) {
+	cols, err := selectColumns([]string{"name", "kills", "input"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	chars := []*characterData{{Name: "Space Mom", Kills: 42, Input: "a < b & c"}}
+	if err := writeXLSX(&buf, cols, chars); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("not a zip: %v", err)
+	}
+
+	var sheet string
+	parts := map[string]bool{}
+	for _, f := range zr.File {
+		parts[f.Name] = true
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			rc, _ := f.Open()
+			b, _ := io.ReadAll(rc)
+			rc.Close()
+			sheet = string(b)
+		}
+	}
+
+	for _, p := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet1.xml"} {
+		if !parts[p] {
+			t.Fatalf("missing part %s", p)
+		}
+	}
+	for _, want := range []string{
+		`<c r="A1" t="inlineStr"><is><t>name</t></is></c>`,
+		`<c r="B2"><v>42</v></c>`,
+		`<t>a &lt; b &amp; c</t>`,
+	} {
+		if !strings.Contains(sheet, want) {
+			t.Fatalf("sheet missing %s:\n%s", want, sheet)
+		}
+	}
+}
+
+func TestXLSXColumnName(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		if got := xlsxColumnName(i); got != want {
+			t.Errorf("xlsxColumnName(%d) = %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestSnapshotExport(t *testing.T) {
+	useSnapshotStore(t)
+
+	s, err := saveSnapshot([]*characterData{{Name: "Space Mom", CharacterID: 123}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/r/"+s.ID+"/export?columns=character_id", nil)
+	rec := httptest.NewRecorder()
+	newRouter().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Body.String() != "character_id\n123\n" {
+		t.Fatalf("unexpected export %d %q", rec.Code, rec.Body.String())
+	}
+	if cd := rec.Header().Get("Content-Disposition"); !strings.Contains(cd, ".csv") {
+		t.Fatalf("unexpected disposition %q", cd)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/r/ZZZZZZZZ/export", nil)
+	rec = httptest.NewRecorder()
+	newRouter().ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown snapshot, got %d", rec.Code)
+	}
+}
+
+func TestSnapshotExport_NeutralizesFormulas(t *testing.T) {
+	useSnapshotStore(t)
+
+	s, err := saveSnapshot([]*characterData{
+		{Name: "Space Mom", Input: `=HYPERLINK("https://zkillboard.com/character/123/")`, Security: -2.5},
+		{Name: "Mynxee", Input: "+cmd", CharacterID: -1},
+		{Name: "Nobody", Input: "@SUM(A1)"},
+		{Name: "Plain", Input: "https://zkillboard.com/character/123/"},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/r/"+s.ID+"/export?columns=input,security,character_id", nil)
+	rec := httptest.NewRecorder()
+	newRouter().ServeHTTP(rec, req)
+
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// text cells that look like formulas are quoted, numbers are left alone
+	want := [][]string{
+		{"input", "security", "character_id"},
+		{`'=HYPERLINK("https://zkillboard.com/character/123/")`, "-2.50", "0"},
+		{"'+cmd", "0.00", "-1"},
+		{"'@SUM(A1)", "0.00", "0"},
+		{"https://zkillboard.com/character/123/", "0.00", "0"},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("expected %v, got %v", want, rows)
+	}
+	for i := range want {
+		if strings.Join(rows[i], "|") != strings.Join(want[i], "|") {
+			t.Errorf("row %d: expected %v, got %v", i, want[i], rows[i])
+		}
+	}
+}
+
+func TestNeutralizeFormula(t *testing.T) {
+	tests := map[string]string{
+		"":          "",
+		"Mynxee":    "Mynxee",
+		"=1+1":      "'=1+1",
+		"+1":        "'+1",
+		"-1":        "'-1",
+		"@A1":       "'@A1",
+		"\t=1":      "'\t=1",
+		"a=b":       "a=b",
+		"Space Mom": "Space Mom",
+	}
+	for in, want := range tests {
+		if got := neutralizeFormula(in); got != want {
+			t.Errorf("neutralizeFormula(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
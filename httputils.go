@@ -7,6 +7,35 @@ import (
 	"net/http"
 )
 
+// httpError is returned by fetchURL for any non 200 response
+type httpError struct {
+	StatusCode int
+	URL        string
+}
+
+func (e *httpError) Error() string {
+	return fmt.Sprintf("http error %d - %s", e.StatusCode, e.URL)
+}
+
+// Is lets a 404 from upstream match errNotFound
+func (e *httpError) Is(target error) bool {
+	return target == errNotFound && e.StatusCode == http.StatusNotFound
+}
+
+// transportError is returned by fetchURL when no response was received at all
+type transportError struct {
+	URL string
+	Err error
+}
+
+func (e *transportError) Error() string {
+	return fmt.Sprintf("request failed - %s: %v", e.URL, e.Err)
+}
+
+func (e *transportError) Unwrap() error {
+	return e.Err
+}
+
 func fetchURL(ctx context.Context, method, url string, params map[string]string, body io.Reader) ([]byte, error) {
 	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
@@ -26,7 +55,7 @@ func fetchURL(ctx context.Context, method, url string, params map[string]string,
 
 	resp, err := httpClient.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, &transportError{URL: url, Err: err}
 	}
 
 	defer resp.Body.Close()
@@ -36,7 +65,7 @@ func fetchURL(ctx context.Context, method, url string, params map[string]string,
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("http error %d - %s", resp.StatusCode, url)
+		return nil, &httpError{StatusCode: resp.StatusCode, URL: url}
 	}
 
 	return respBody, nil
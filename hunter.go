@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// covert hulls by group, what cloaked hunters fly
+var covertHullGroups = map[int]bool{
+	830: true, // Covert Ops
+	833: true, // Force Recon Ship
+	834: true, // Stealth Bomber
+	898: true, // Black Ops
+	963: true, // Strategic Cruiser
+}
+
+// covert hulls outside those groups
+var covertHullTypes = map[int]bool{
+	33470: true, // Stratios
+}
+
+// cloaks that can warp cloaked
+var covertCloaks = map[int]bool{
+	11578: true, // Covert Ops Cloaking Device II
+}
+
+// a character is a cloaky hunter with at least this many kills in covert
+// hulls making up at least this share of their kills, or with a covert kill
+// and a hunting fit among their losses
+const (
+	hunterMinKills = 2
+	hunterMinShare = 25
+)
+
+// hunterExample is the most recent kill or loss behind a hunter profile,
+// Source is "kill" or "loss" and Date the ESI timestamp
+type hunterExample struct {
+	KillmailID int    `json:"killmail_id"`
+	Date       string `json:"date"`
+	ShipTypeID int    `json:"ship_type_id"`
+	Source     string `json:"source"`
+}
+
+// hunterProfile gathers what the kill and loss analysis see of covert hulls
+type hunterProfile struct {
+	kills       int
+	covertKills int
+	hunterFits  int
+	example     *hunterExample
+}
+
+// isCovertHull tells whether a ship is one cloaked hunters fly, types that
+// can't be resolved are taken not to be
+func isCovertHull(ctx context.Context, shipTypeID int) bool {
+	if shipTypeID == 0 {
+		return false
+	}
+	if covertHullTypes[shipTypeID] {
+		return true
+	}
+	ti, err := fetchTypeInfo(ctx, shipTypeID)
+	if err != nil {
+		log.WithError(err).WithField("type", shipTypeID).Debug("failed to fetch hull")
+		return false
+	}
+	return covertHullGroups[ti.GroupID]
+}
+
+// isHunterFit tells whether a loss was a covert hull, other than a covert
+// ops frigate, with a covert ops cloak fitted
+func isHunterFit(ctx context.Context, km *killMail) bool {
+	cloaked := false
+	for _, item := range km.Victim.Items {
+		if item.Flag >= flagHighSlot0 && item.Flag <= flagHighSlot7 && covertCloaks[item.TypeID] {
+			cloaked = true
+			break
+		}
+	}
+	if !cloaked {
+		return false
+	}
+	if covertHullTypes[km.Victim.ShipTypeID] {
+		return true
+	}
+	ti, err := fetchTypeInfo(ctx, km.Victim.ShipTypeID)
+	if err != nil {
+		log.WithError(err).WithField("type", km.Victim.ShipTypeID).Debug("failed to fetch hull")
+		return false
+	}
+	// covert ops frigates carry explorers as often as hunters, a covert ops
+	// cloak lost in one of them says nothing
+	return covertHullGroups[ti.GroupID] && ti.GroupID != groupCovertOps
+}
+
+// seen keeps ex as the example if it is more recent than the current one
+func (p *hunterProfile) seen(ex hunterExample) {
+	if p.example == nil || ex.Date > p.example.Date {
+		p.example = &ex
+	}
+}
+
+// apply fills in the hunter fields of a character
+func (p *hunterProfile) apply(cd *characterData) {
+	if p.kills != 0 {
+		cd.CovertKillShare = p.covertKills * 100 / p.kills
+	}
+	cd.CloakyHunter = p.covertKills >= hunterMinKills && cd.CovertKillShare >= hunterMinShare ||
+		p.covertKills != 0 && p.hunterFits != 0
+	if cd.CloakyHunter {
+		cd.HunterExample = p.example
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	cache "zgo.at/zcache/v2"
+)
+
+func TestFetchKillHistory_CloakyHunter(t *testing.T) {
+	ccpCache = cache.New[string, any](1*time.Hour, 10*time.Minute)
+	zkillCache = cache.New[string, any](1*time.Hour, 10*time.Minute)
+	killmailCache = cache.New[string, any](1*time.Hour, 10*time.Minute)
+
+	// hulls are known so no static data is fetched
+	ccpCache.Set("typeinfo:12038", typeInfo{ID: 12038, Name: "Purifier", GroupID: 834})
+	ccpCache.Set("typeinfo:587", typeInfo{ID: 587, Name: "Rifter", GroupID: 25})
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/kills/characterID/7/":
+			_ = json.NewEncoder(w).Encode([]zKillMail{
+				{ID: 3, Info: zKillMailInfo{Hash: "h3"}},
+				{ID: 2, Info: zKillMailInfo{Hash: "h2"}},
+				{ID: 1, Info: zKillMailInfo{Hash: "h1"}},
+			})
+		case "/killmails/1/h1/":
+			_ = json.NewEncoder(w).Encode(killMail{Time: "2026-10-01T00:00:00Z", Attackers: []zKillCharInfo{{CharacterID: 7, ShipTypeID: 587}}})
+		case "/killmails/2/h2/":
+			_ = json.NewEncoder(w).Encode(killMail{Time: "2026-10-02T00:00:00Z", Attackers: []zKillCharInfo{{CharacterID: 7, ShipTypeID: 33470}}})
+		case "/killmails/3/h3/":
+			_ = json.NewEncoder(w).Encode(killMail{Time: "2026-10-03T00:00:00Z", Attackers: []zKillCharInfo{{CharacterID: 7, ShipTypeID: 12038}}})
+		case "/losses/characterID/7/":
+			_ = json.NewEncoder(w).Encode([]zKillMail{{ID: 4, Info: zKillMailInfo{Hash: "h4"}}})
+		case "/killmails/4/h4/":
+			_ = json.NewEncoder(w).Encode(killMail{Time: "2026-10-04T00:00:00Z", Victim: zKillCharInfo{
+				CharacterID: 7, ShipTypeID: 12038,
+				Items: []killItem{{TypeID: 11578, Flag: 28}},
+			}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+
+	origZkill := zkillAPIURL
+	origCcp := ccpEsiURL
+	zkillAPIURL = s.URL + "/"
+	ccpEsiURL = s.URL + "/"
+	defer func() { zkillAPIURL = origZkill; ccpEsiURL = origCcp }()
+
+	cd := analyzeKillmails(t, 7)
+	if !cd.CloakyHunter {
+		t.Fatal("expected a cloaky hunter")
+	}
+	if cd.CovertKillShare != 66 {
+		t.Errorf("covert kill share = %d, want 66", cd.CovertKillShare)
+	}
+	// the kills and the loss make the activity
+	if cd.Activity == nil || cd.Activity.Samples != 4 {
+		t.Errorf("activity = %+v, want 4 samples", cd.Activity)
+	}
+	want := hunterExample{KillmailID: 4, Date: "2026-10-04T00:00:00Z", ShipTypeID: 12038, Source: "loss"}
+	if cd.HunterExample == nil || *cd.HunterExample != want {
+		t.Errorf("example = %+v, want %+v", cd.HunterExample, want)
+	}
+}
+
+func TestHunterProfile_Apply(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile hunterProfile
+		want    bool
+		share   int
+	}{
+		{"no kills", hunterProfile{}, false, 0},
+		{"mostly covert", hunterProfile{kills: 4, covertKills: 2}, true, 50},
+		{"one covert kill", hunterProfile{kills: 2, covertKills: 1}, false, 50},
+		{"covert kill and fit", hunterProfile{kills: 2, covertKills: 1, hunterFits: 1}, true, 50},
+		{"rarely covert", hunterProfile{kills: 20, covertKills: 2}, false, 10},
+		{"fit without kills", hunterProfile{kills: 5, hunterFits: 3}, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cd characterData
+			tt.profile.apply(&cd)
+			if cd.CloakyHunter != tt.want || cd.CovertKillShare != tt.share {
+				t.Errorf("got hunter %v share %d, want %v %d", cd.CloakyHunter, cd.CovertKillShare, tt.want, tt.share)
+			}
+		})
+	}
+}
+
+func TestIsHunterFit(t *testing.T) {
+	ccpCache = cache.New[string, any](1*time.Hour, 10*time.Minute)
+	ccpCache.Set("typeinfo:12038", typeInfo{ID: 12038, Name: "Purifier", GroupID: 834})
+	ccpCache.Set("typeinfo:11188", typeInfo{ID: 11188, Name: "Anathema", GroupID: 830})
+
+	cloak := []killItem{{TypeID: 11578, Flag: 27}}
+	tests := []struct {
+		name string
+		km   killMail
+		want bool
+	}{
+		{"bomber with cloak", killMail{Victim: zKillCharInfo{ShipTypeID: 12038, Items: cloak}}, true},
+		{"stratios with cloak", killMail{Victim: zKillCharInfo{ShipTypeID: 33470, Items: cloak}}, true},
+		// explorers fly covert ops frigates with the same cloak
+		{"covert ops frigate", killMail{Victim: zKillCharInfo{ShipTypeID: 11188, Items: cloak}}, false},
+		{"bomber without cloak", killMail{Victim: zKillCharInfo{ShipTypeID: 12038}}, false},
+		{"cloak in cargo", killMail{Victim: zKillCharInfo{ShipTypeID: 12038, Items: []killItem{{TypeID: 11578, Flag: 5}}}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isHunterFit(context.Background(), &tt.km); got != tt.want {
+				t.Errorf("isHunterFit = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
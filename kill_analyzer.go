@@ -8,18 +8,28 @@ import (
 	"time"
 
 	json "github.com/goccy/go-json"
+	log "github.com/sirupsen/logrus"
 	cache "zgo.at/zcache/v2"
 )
 
 type zKillCharInfo struct {
-	CharacterID   int `json:"character_id"`
-	CorporationID int `json:"corporation_id"`
-	AllianceID    int `json:"alliance_id"`
-	ShipTypeID    int `json:"ship_type_id"`
+	CharacterID   int  `json:"character_id"`
+	CorporationID int  `json:"corporation_id"`
+	AllianceID    int  `json:"alliance_id"`
+	ShipTypeID    int  `json:"ship_type_id"`
+	FinalBlow     bool `json:"final_blow"`
+	// only the victim has items, what was fitted and carried
+	Items []killItem `json:"items,omitempty"`
+}
+
+type killItem struct {
+	TypeID int `json:"item_type_id"`
+	Flag   int `json:"flag"`
 }
 
 type killMail struct {
 	Time      string          `json:"killmail_time"`
+	SystemID  int             `json:"solar_system_id"`
 	Victim    zKillCharInfo   `json:"victim"`
 	Attackers []zKillCharInfo `json:"attackers"`
 }
@@ -34,6 +44,7 @@ type zKillMail struct {
 }
 
 var (
+	// default for lookups that don't ask, see lookupOptions
 	computeFavoriteShip = false
 	killmailCache       = cache.New[string, any](1*time.Hour, 10*time.Minute)
 )
@@ -41,37 +52,51 @@ var (
 // singleflight for killmail fetches to deduplicate inflight requests
 var killmailSingleFlight struct {
 	mu sync.Mutex
-	m  map[string]*inflight
+	m  map[string]*inflight[*killMail]
+}
+
+// and for the loss lists, which the cyno and loss analysis both ask for at
+// the same time
+var lossesSingleFlight struct {
+	mu sync.Mutex
+	m  map[string]*inflight[[]zKillMail]
 }
 
-type inflight struct {
+type inflight[T any] struct {
 	wg  sync.WaitGroup
-	res *killMail
+	res T
 	err error
 }
 
 func ccpGetKillMail(ctx context.Context, id int, hash string) *killMail {
+	km, _ := fetchKillMail(ctx, id, hash)
+	return km
+}
+
+// fetchKillMail is ccpGetKillMail for callers that need to know it failed,
+// the killmail is empty but never nil on error
+func fetchKillMail(ctx context.Context, id int, hash string) (*killMail, error) {
 	// check cache first
 	key := fmt.Sprintf("%d:%s", id, hash)
 	if rec, found := killmailCache.Get(key); found {
 		km := rec.(killMail)
-		return &km
+		return &km, nil
 	}
 
 	// singleflight: check or join inflight
 	killmailSingleFlight.mu.Lock()
 	if killmailSingleFlight.m == nil {
-		killmailSingleFlight.m = make(map[string]*inflight)
+		killmailSingleFlight.m = make(map[string]*inflight[*killMail])
 	}
 	if in, ok := killmailSingleFlight.m[key]; ok {
 		// join existing inflight - leader has already added to the WaitGroup
 		killmailSingleFlight.mu.Unlock()
 		in.wg.Wait()
 		// even on error, return what the leader got
-		return in.res
+		return in.res, in.err
 	}
 	// become the leader
-	in := &inflight{}
+	in := &inflight[*killMail]{}
 	in.wg.Add(1)
 	killmailSingleFlight.m[key] = in
 	killmailSingleFlight.mu.Unlock()
@@ -81,9 +106,7 @@ func ccpGetKillMail(ctx context.Context, id int, hash string) *killMail {
 	ids := fmt.Sprint(id)
 	jsonPayload, err := ccpGet(ctx, "killmails/"+ids+"/"+hash+"/", nil)
 	if err == nil {
-		if err := json.Unmarshal(jsonPayload, &km); err != nil {
-			err = err
-		}
+		err = json.Unmarshal(jsonPayload, &km)
 	}
 
 	// store result and wake up waiters
@@ -98,7 +121,98 @@ func ccpGetKillMail(ctx context.Context, id int, hash string) *killMail {
 		killmailCache.Set(key, km)
 	}
 
-	return &km
+	return &km, err
+}
+
+// most recent losses looked at by the loss analysis
+const recentLossesChecked = 25
+
+// recentLoss is a killmail the character was the victim of
+type recentLoss struct {
+	id int
+	km *killMail
+}
+
+// fetchRecentLosses fetches the killmails of the last recentLossesChecked
+// losses of a character, newest first. Killmails that can't be fetched are
+// left out.
+func fetchRecentLosses(ctx context.Context, id int) ([]recentLoss, error) {
+	entries, err := fetchLossList(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	mails := make([]*killMail, len(entries))
+	// cap concurrency like fetchKillHistory
+	sem := make(chan struct{}, 10)
+	var wg sync.WaitGroup
+	for i, entry := range entries {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			km, err := fetchKillMail(ctx, entry.ID, entry.Info.Hash)
+			if err == nil && km.Victim.CharacterID == id {
+				mails[i] = km
+			}
+		}()
+	}
+	wg.Wait()
+
+	losses := make([]recentLoss, 0, len(entries))
+	for i, km := range mails {
+		if km != nil {
+			losses = append(losses, recentLoss{entries[i].ID, km})
+		}
+	}
+	return losses, nil
+}
+
+// fetchLossList gets the last recentLossesChecked losses of a character from
+// zKillboard. The list is kept in zkillCache as the cyno and loss analysis
+// both read it, and a fetch already under way is joined rather than repeated.
+func fetchLossList(ctx context.Context, id int) ([]zKillMail, error) {
+	key := fmt.Sprint("losses:", id)
+	if rec, found := zkillCache.Get(key); found {
+		if entries, ok := rec.([]zKillMail); ok {
+			return entries, nil
+		}
+	}
+
+	lossesSingleFlight.mu.Lock()
+	if lossesSingleFlight.m == nil {
+		lossesSingleFlight.m = make(map[string]*inflight[[]zKillMail])
+	}
+	if in, ok := lossesSingleFlight.m[key]; ok {
+		lossesSingleFlight.mu.Unlock()
+		in.wg.Wait()
+		return in.res, in.err
+	}
+	in := &inflight[[]zKillMail]{}
+	in.wg.Add(1)
+	lossesSingleFlight.m[key] = in
+	lossesSingleFlight.mu.Unlock()
+
+	var entries []zKillMail
+	jsonPayload, err := zkillGet(ctx, fmt.Sprintf("losses/characterID/%d/", id))
+	if err == nil {
+		err = json.Unmarshal(jsonPayload, &entries)
+	}
+	if err == nil {
+		entries = entries[:min(len(entries), recentLossesChecked)]
+		zkillCache.Set(key, entries)
+	} else {
+		entries = nil
+	}
+
+	lossesSingleFlight.mu.Lock()
+	in.res, in.err = entries, err
+	in.wg.Done()
+	delete(lossesSingleFlight.m, key)
+	lossesSingleFlight.mu.Unlock()
+
+	return entries, err
 }
 
 func fetchLastKillActivity(ctx context.Context, id int) *characterResponse {
@@ -137,6 +251,8 @@ func fetchLastKillActivity(ctx context.Context, id int) *characterResponse {
 	}
 
 	cd.LastKill = when + " (" + what + ")"
+	cd.LastKillAt = km.Time
+	cd.LastKillKind = what
 
 	return &characterResponse{&cd, nil}
 }
@@ -165,12 +281,10 @@ func fetchKillHistory(ctx context.Context, id int) *characterResponse {
 
 	cd.RecentKillTotal = len(entries)
 
-	explorerShips := map[int]bool{
-		29248: true, 11188: true, 11192: true,
-		605: true, 11172: true, 607: true,
-		11182: true, 586: true, 33468: true, 33470: true}
-
 	explorerTotal := 0
+	// kills whose killmail can't be fetched are left out of the breakdowns
+	h := newKillmailHistory()
+	associates := newCoAttackers()
 	shipFreq := make(map[int]int)
 	var mu sync.Mutex
 	// cap concurrency to avoid rate limiting and spikes
@@ -182,17 +296,26 @@ func fetchKillHistory(ctx context.Context, id int) *characterResponse {
 		go func(entry zKillMail, last bool) {
 			defer wg.Done()
 			defer func() { <-sem }()
-			km := ccpGetKillMail(ctx, entry.ID, entry.Info.Hash)
-			if km == nil {
+			km, err := fetchKillMail(ctx, entry.ID, entry.Info.Hash)
+			if err != nil {
+				log.WithError(err).WithField("killmail", entry.ID).Debug("failed to fetch kill")
 				return
 			}
+			class := classifyShip(ctx, km.Victim.ShipTypeID)
+			explorer := isExplorerShip(km.Victim.ShipTypeID, class)
 			localExplorer := 0
+			localCovert := 0
 			localFreq := make(map[int]int)
+			var example hunterExample
 			for _, attacker := range km.Attackers {
 				if attacker.CharacterID == id {
-					if explorerShips[km.Victim.ShipTypeID] {
+					if explorer {
 						localExplorer++
 					}
+					if isCovertHull(ctx, attacker.ShipTypeID) {
+						localCovert++
+						example = hunterExample{entry.ID, km.Time, attacker.ShipTypeID, "kill"}
+					}
 					localFreq[attacker.ShipTypeID]++
 				}
 			}
@@ -201,6 +324,15 @@ func fetchKillHistory(ctx context.Context, id int) *characterResponse {
 				cd.LastKillTime = getDate(km.Time)
 			}
 			explorerTotal += localExplorer
+			h.hunter.kills++
+			h.times = append(h.times, km.Time)
+			h.systems = append(h.systems, km.SystemID)
+			h.killClasses[class]++
+			associates.add(km, id)
+			if localCovert != 0 {
+				h.hunter.covertKills += localCovert
+				h.hunter.seen(example)
+			}
 			for ship, cnt := range localFreq {
 				shipFreq[ship] += cnt
 			}
@@ -210,8 +342,10 @@ func fetchKillHistory(ctx context.Context, id int) *characterResponse {
 	wg.Wait()
 
 	cd.RecentExplorerTotal = explorerTotal
+	cd.Associates = associates.top(ctx)
+	cd.history = h
 
-	if computeFavoriteShip {
+	if settingsFrom(ctx).favoriteShip {
 		// pick the ship with the highest count
 		bestID := 0
 		bestCnt := 0
@@ -228,12 +362,91 @@ func fetchKillHistory(ctx context.Context, id int) *characterResponse {
 	return &characterResponse{&cd, nil}
 }
 
+// fetchLossHistory adds the recent losses of a character to the analysis,
+// losses show the fit where kills only show the hull. Like the cyno evidence
+// it leaves out losses that can't be fetched rather than failing the lookup.
+func fetchLossHistory(ctx context.Context, id int) *characterResponse {
+	cd := characterData{}
+
+	losses, err := fetchRecentLosses(ctx, id)
+	if err != nil {
+		log.WithError(err).WithField("id", id).Warn("failed to fetch losses")
+		return &characterResponse{&cd, nil}
+	}
+
+	h := newKillmailHistory()
+	for _, loss := range losses {
+		h.times = append(h.times, loss.km.Time)
+		h.systems = append(h.systems, loss.km.SystemID)
+		h.lossClasses[classifyShip(ctx, loss.km.Victim.ShipTypeID)]++
+		if isHunterFit(ctx, loss.km) {
+			h.hunter.hunterFits++
+			h.hunter.seen(hunterExample{loss.id, loss.km.Time, loss.km.Victim.ShipTypeID, "loss"})
+		}
+	}
+	cd.history = h
+
+	return &characterResponse{&cd, nil}
+}
+
+// killmailHistory is what the kill and loss analysis each gather for the
+// fields made from both, fetchDetails joins the two once they have run
+type killmailHistory struct {
+	// when and where the kills and losses happened, for the activity heatmap
+	// and locations
+	times   []string
+	systems []int
+	// ships destroyed and lost by class
+	killClasses map[string]int
+	lossClasses map[string]int
+	hunter      hunterProfile
+}
+
+func newKillmailHistory() *killmailHistory {
+	return &killmailHistory{killClasses: make(map[string]int), lossClasses: make(map[string]int)}
+}
+
+// join adds o to h, either may be nil
+func (h *killmailHistory) join(o *killmailHistory) *killmailHistory {
+	if h == nil {
+		return o
+	}
+	if o == nil {
+		return h
+	}
+	h.times = append(h.times, o.times...)
+	h.systems = append(h.systems, o.systems...)
+	for class, n := range o.killClasses {
+		h.killClasses[class] += n
+	}
+	for class, n := range o.lossClasses {
+		h.lossClasses[class] += n
+	}
+	h.hunter.kills += o.hunter.kills
+	h.hunter.covertKills += o.hunter.covertKills
+	h.hunter.hunterFits += o.hunter.hunterFits
+	if o.hunter.example != nil {
+		h.hunter.seen(*o.hunter.example)
+	}
+	return h
+}
+
+// apply fills in the fields made from kills and losses together
+func (h *killmailHistory) apply(ctx context.Context, cd *characterData) {
+	h.hunter.apply(cd)
+	cd.Activity = newActivity(h.times)
+	cd.Locations = fetchLocations(ctx, h.systems)
+	cd.ShipClasses = newShipClassData(h.killClasses, h.lossClasses)
+}
+
 func fetchRecentKillHistory(ctx context.Context, id int) *characterResponse {
 	cd := characterData{KillsLastWeek: 0}
 
 	ids := fmt.Sprint(id)
 
-	jsonPayload, err := zkillGet(ctx, "kills/characterID/"+ids+"/pastSeconds/"+fmt.Sprint(secondsInWeek)+"/")
+	window := settingsFrom(ctx).killWindow
+
+	jsonPayload, err := zkillGet(ctx, "kills/characterID/"+ids+"/pastSeconds/"+fmt.Sprint(window)+"/")
 	if err != nil {
 		return &characterResponse{&cd, err}
 	}
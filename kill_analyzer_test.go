@@ -6,12 +6,34 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	cache "zgo.at/zcache/v2"
 )
 
+// analyzeKillmails runs the kill and the loss analysis of a character and
+// joins them the way fetchDetails does
+func analyzeKillmails(t *testing.T, id int) *characterData {
+	t.Helper()
+
+	ctx := context.Background()
+	ch := make(chan *characterResponse, 2)
+	ch <- fetchKillHistory(ctx, id)
+	ch <- fetchLossHistory(ctx, id)
+	close(ch)
+
+	var cd characterData
+	if err := cd.handleMerges(ch); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if cd.history != nil {
+		cd.history.apply(ctx, &cd)
+	}
+	return &cd
+}
+
 func TestFetchRecentKillHistory_Counts(t *testing.T) {
 	// start a test server to serve zkill responses
 	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -313,7 +335,7 @@ func TestKillmailSingleflight_Deduplication(t *testing.T) {
 	killmailCache = cache.New[string, any](1*time.Hour, 10*time.Minute)
 	killmailSingleFlight = struct {
 		mu sync.Mutex
-		m  map[string]*inflight
+		m  map[string]*inflight[*killMail]
 	}{}
 
 	var wg sync.WaitGroup
@@ -341,3 +363,70 @@ func TestKillmailSingleflight_Deduplication(t *testing.T) {
 		}
 	}
 }
+
+func TestFetchLossList_Shared(t *testing.T) {
+	zkillCache = cache.New[string, any](1*time.Hour, 10*time.Minute)
+	killmailCache = cache.New[string, any](1*time.Hour, 10*time.Minute)
+
+	var hits atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/losses/characterID/3/":
+			hits.Add(1)
+			// slow enough for the other fetcher to join
+			time.Sleep(50 * time.Millisecond)
+			_ = json.NewEncoder(w).Encode([]zKillMail{{ID: 4, Info: zKillMailInfo{Hash: "h4"}}})
+		case "/killmails/4/h4/":
+			_ = json.NewEncoder(w).Encode(killMail{Time: "2020-01-01T00:00:00Z", Victim: zKillCharInfo{CharacterID: 3}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+
+	origZkill := zkillAPIURL
+	origCcp := ccpEsiURL
+	zkillAPIURL = s.URL + "/"
+	ccpEsiURL = s.URL + "/"
+	defer func() { zkillAPIURL = origZkill; ccpEsiURL = origCcp }()
+
+	// the cyno and loss analysis run side by side in fetchDetails
+	var wg sync.WaitGroup
+	for _, f := range []func(context.Context, int) *characterResponse{fetchCynoEvidence, fetchLossHistory} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f(context.Background(), 3)
+		}()
+	}
+	wg.Wait()
+
+	if n := hits.Load(); n != 1 {
+		t.Fatalf("expected the loss list to be fetched once, got %d", n)
+	}
+}
+
+func TestFetchRecentKillHistory_KillWindow(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/kills/characterID/123/pastSeconds/86400/" {
+			_ = json.NewEncoder(w).Encode([]killMail{{Time: "2020-01-01T00:00:00Z"}})
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer s.Close()
+
+	origZkill := zkillAPIURL
+	zkillAPIURL = s.URL + "/"
+	defer func() { zkillAPIURL = origZkill }()
+
+	ctx := withSettings(context.Background(), lookupOptions{KillWindowDays: 1}.settings())
+
+	r := fetchRecentKillHistory(ctx, 123)
+	if r.err != nil {
+		t.Fatalf("unexpected err: %v", r.err)
+	}
+	if r.char.KillsLastWeek != 1 {
+		t.Fatalf("expected 1 kill in the window, got %d", r.char.KillsLastWeek)
+	}
+}
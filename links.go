@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	json "github.com/goccy/go-json"
+	log "github.com/sirupsen/logrus"
+)
+
+// pasted links, zKillboard kill, character, corporation and alliance pages and
+// ESI killmails
+var (
+	zkillKillRegex      = regexp.MustCompile(`zkillboard\.com/kill/(\d+)`)
+	esiKillmailRegex    = regexp.MustCompile(`/killmails/(\d+)/([0-9a-fA-F]+)`)
+	zkillCharacterRegex = regexp.MustCompile(`zkillboard\.com/character/(\d+)`)
+	zkillEntityRegex    = regexp.MustCompile(`zkillboard\.com/(corporation|alliance)/(\d+)`)
+)
+
+// roles of a character on a pasted kill
+const (
+	roleVictim    = "victim"
+	roleAttacker  = "attacker"
+	roleFinalBlow = "final_blow"
+)
+
+// killLink is a pasted kill, hash is empty until looked up on zKillboard
+type killLink struct {
+	id   int
+	hash string
+}
+
+// killInvolvement is how a character took part in a pasted kill
+type killInvolvement struct {
+	KillmailID int    `json:"killmail_id"`
+	Role       string `json:"role"`
+}
+
+// parseLink recognises a line holding a link, ok is false for anything else
+func parseLink(index int, line string) (pasteLine, bool) {
+	pl := pasteLine{index: index, input: line, format: formatLinks}
+
+	if m := esiKillmailRegex.FindStringSubmatch(line); m != nil {
+		id, _ := strconv.Atoi(m[1])
+		pl.killmail = &killLink{id: id, hash: m[2]}
+		return pl, true
+	}
+	if m := zkillKillRegex.FindStringSubmatch(line); m != nil {
+		id, _ := strconv.Atoi(m[1])
+		pl.killmail = &killLink{id: id}
+		return pl, true
+	}
+	if m := zkillCharacterRegex.FindStringSubmatch(line); m != nil {
+		pl.id, _ = strconv.Atoi(m[1])
+		return pl, true
+	}
+	if m := zkillEntityRegex.FindStringSubmatch(line); m != nil {
+		pl.entity = m[1]
+		pl.id, _ = strconv.Atoi(m[2])
+		return pl, true
+	}
+
+	return pl, false
+}
+
+// fetchKillHash finds the hash ESI needs for a killmail on zKillboard
+func fetchKillHash(ctx context.Context, id int) (string, error) {
+	jsonPayload, err := zkillGet(ctx, fmt.Sprintf("killID/%d/", id))
+	if err != nil {
+		return "", err
+	}
+
+	var entries []zKillMail
+	if err := json.Unmarshal(jsonPayload, &entries); err != nil {
+		return "", err
+	}
+	if len(entries) == 0 || entries[0].Info.Hash == "" {
+		return "", fmt.Errorf("kill %d %w", id, errNotFound)
+	}
+
+	return entries[0].Info.Hash, nil
+}
+
+// killJobs turns a kill into a job for every character involved, the victim
+// first. NPCs and structures without a pilot are left out.
+func killJobs(ctx context.Context, job lookupJob) ([]lookupJob, error) {
+	kl := *job.killmail
+	if kl.hash == "" {
+		hash, err := fetchKillHash(ctx, kl.id)
+		if err != nil {
+			return nil, err
+		}
+		kl.hash = hash
+	}
+
+	km, err := fetchKillMail(ctx, kl.id, kl.hash)
+	if err != nil {
+		return nil, err
+	}
+
+	involved := func(id int, role string) lookupJob {
+		return lookupJob{
+			index: job.index,
+			input: job.input,
+			id:    id,
+			kill:  &killInvolvement{KillmailID: kl.id, Role: role},
+		}
+	}
+
+	var jobs []lookupJob
+	if km.Victim.CharacterID != 0 {
+		jobs = append(jobs, involved(km.Victim.CharacterID, roleVictim))
+	}
+	for _, a := range km.Attackers {
+		if a.CharacterID == 0 {
+			continue
+		}
+		role := roleAttacker
+		if a.FinalBlow {
+			role = roleFinalBlow
+		}
+		jobs = append(jobs, involved(a.CharacterID, role))
+	}
+
+	return jobs, nil
+}
+
+// expandLinks replaces pasted kills with the characters involved in them,
+// keeping the first job for any character and stopping at limit jobs. Kills
+// that can't be fetched and jobs past the limit come back as failed results,
+// kills past the limit aren't fetched.
+func expandLinks(ctx context.Context, jobs []lookupJob, limit int) ([]lookupJob, []lookupResult) {
+	expanded := make([]lookupJob, 0, len(jobs))
+	var failed []lookupResult
+
+	seen := make(map[int]bool)
+	add := func(j lookupJob) {
+		if j.id != 0 {
+			if seen[j.id] {
+				return
+			}
+			seen[j.id] = true
+		}
+		if len(expanded) >= limit {
+			failed = append(failed, truncatedResult(j, limit))
+			return
+		}
+		expanded = append(expanded, j)
+	}
+
+	for _, job := range jobs {
+		if job.killmail == nil {
+			add(job)
+			continue
+		}
+		if len(expanded) >= limit {
+			failed = append(failed, truncatedResult(job, limit))
+			continue
+		}
+
+		involved, err := killJobs(ctx, job)
+		if err != nil {
+			log.WithError(err).WithField("kill", job.killmail.id).Warn("failed to expand kill")
+			err = newLookupError(job.input, 0, err)
+			failed = append(failed, lookupResult{job: job, characterResponse: &characterResponse{nil, err}})
+			continue
+		}
+
+		for _, j := range involved {
+			add(j)
+		}
+	}
+
+	return expanded, failed
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseLink(t *testing.T) {
+	tests := []struct {
+		line       string
+		wantOK     bool
+		wantID     int
+		wantKill   int
+		wantHash   string
+		wantEntity string
+	}{
+		{"https://zkillboard.com/kill/77/", true, 0, 77, "", ""},
+		{"https://esi.evetech.net/latest/killmails/77/abc123/?datasource=tranquility", true, 0, 77, "abc123", ""},
+		{"https://zkillboard.com/character/2112625428/", true, 2112625428, 0, "", ""},
+		{"https://zkillboard.com/corporation/98000001/", true, 98000001, 0, "", entityCorporation},
+		{"https://zkillboard.com/alliance/99000001/", true, 99000001, 0, "", entityAlliance},
+		{"Mynxee", false, 0, 0, "", ""},
+	}
+
+	for _, tt := range tests {
+		pl, ok := parseLink(0, tt.line)
+		if ok != tt.wantOK {
+			t.Fatalf("parseLink(%q) ok = %v", tt.line, ok)
+		}
+		if !ok {
+			continue
+		}
+		if pl.id != tt.wantID || pl.entity != tt.wantEntity {
+			t.Fatalf("parseLink(%q) = %+v", tt.line, pl)
+		}
+		if tt.wantKill != 0 && (pl.killmail == nil || pl.killmail.id != tt.wantKill || pl.killmail.hash != tt.wantHash) {
+			t.Fatalf("parseLink(%q) killmail = %+v", tt.line, pl.killmail)
+		}
+	}
+}
+
+func TestExpandLinks(t *testing.T) {
+	fakeUpstream(t)
+
+	p := parsePaste("Mynxee\nhttps://zkillboard.com/kill/77/\nhttps://zkillboard.com/kill/78/\nhttps://zkillboard.com/character/123/", 10)
+	if p.format != formatLinks || len(p.jobs) != 4 {
+		t.Fatalf("unexpected paste %+v", p)
+	}
+
+	jobs, failed := expandLinks(context.Background(), p.jobs, 10)
+
+	if len(failed) != 1 || failed[0].job.index != 2 || classifyError(failed[0].err) != kindNotFound {
+		t.Fatalf("expected kill 78 to fail as not found, got %+v", failed)
+	}
+
+	// the name, the victim and the final blow, the character link is the
+	// victim again
+	if len(jobs) != 3 {
+		t.Fatalf("expected 3 jobs, got %+v", jobs)
+	}
+	if jobs[0].name != "Mynxee" {
+		t.Fatalf("unexpected first job %+v", jobs[0])
+	}
+	victim, final := jobs[1], jobs[2]
+	if victim.id != 123 || *victim.kill != (killInvolvement{KillmailID: 77, Role: roleVictim}) || victim.index != 1 {
+		t.Fatalf("unexpected victim %+v", victim)
+	}
+	if final.id != 500 || final.kill.Role != roleFinalBlow {
+		t.Fatalf("unexpected attacker %+v", final)
+	}
+
+	if jobs, _ := expandLinks(context.Background(), p.jobs, 2); len(jobs) != 2 {
+		t.Fatalf("expected the limit to stop at 2 jobs, got %d", len(jobs))
+	}
+}
+
+func TestServeData_KillLink(t *testing.T) {
+	fakeUpstream(t)
+
+	records := postInfo(t, "https://zkillboard.com/kill/77/")
+
+	if len(records) != 4 || records[0]["total"] != 2.0 || records[0]["format"] != "links" {
+		t.Fatalf("expected the kill to expand to 2 lookups, got %v", records)
+	}
+
+	var victim, attacker bool
+	for _, r := range records[1:3] {
+		kill, _ := r["kill"].(map[string]any)
+		switch {
+		case r["_meta"] == nil:
+			victim = r["name"] == "Space Mom" && kill["role"] == "victim" && kill["killmail_id"] == 77.0
+		case r["_meta"] == "error":
+			attacker = r["id"] == 500.0 && r["kind"] == "upstream" && kill["role"] == "final_blow"
+		}
+	}
+	if !victim || !attacker {
+		t.Fatalf("expected the victim and a failed attacker, got %v", records[1:3])
+	}
+}
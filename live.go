@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	json "github.com/goccy/go-json"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/websocket"
+)
+
+// message from the client on the live websocket
+//
+//	{"op": "add", "names": [...]}     add names to the session
+//	{"op": "remove", "names": [...]}  drop names from the session
+//	{"op": "sync", "names": [...]}    replace the session with a full list
+//	{"op": "refresh"}                 fetch every name again
+//
+// any message may carry "options", which apply to all later fetches
+type liveRequest struct {
+	Op    string   `json:"op"`
+	Names []string `json:"names"`
+	// replaces the lookup options of the session when present
+	Options *lookupOptions `json:"options"`
+}
+
+// message to the client, Row or for a corporation or alliance Entity is set
+// for add and update, the error fields for error messages
+type liveMessage struct {
+	Type    string         `json:"type"`
+	Name    string         `json:"name"`
+	Row     *characterData `json:"row,omitempty"`
+	Entity  *entityData    `json:"entity,omitempty"`
+	Kind    errorKind      `json:"kind,omitempty"`
+	Message string         `json:"message,omitempty"`
+}
+
+// liveSession is the character set of one websocket connection. Only names
+// that are new to the set are fetched, so a client can follow Local by sending
+// the few names that changed.
+type liveSession struct {
+	ctx context.Context
+	out chan liveMessage
+
+	mu       sync.Mutex
+	settings lookupSettings
+	// every name in the session by nameKey, so any spelling of a name finds
+	// the same member
+	members map[string]*liveMember
+}
+
+// liveMember is a name in a live session, name is spelled as first sent and
+// row, or entity for a corporation or alliance, is nil until its first fetch
+// completes
+type liveMember struct {
+	name   string
+	row    *characterData
+	entity *entityData
+}
+
+func (m *liveMember) fetched() bool {
+	return m.row != nil || m.entity != nil
+}
+
+func newLiveSession(ctx context.Context) *liveSession {
+	return &liveSession{
+		ctx:      ctx,
+		out:      make(chan liveMessage, maxWorkers),
+		settings: defaultSettings(),
+		members:  make(map[string]*liveMember),
+	}
+}
+
+func (s *liveSession) send(m liveMessage) {
+	select {
+	case s.out <- m:
+	case <-s.ctx.Done():
+	}
+}
+
+func (s *liveSession) handle(req liveRequest) {
+	s.mu.Lock()
+	if req.Options != nil {
+		s.settings = req.Options.settings()
+	}
+	limit := s.settings.maxNames
+	s.mu.Unlock()
+
+	text := strings.Join(req.Names, "\n")
+	p := parsePaste(text, limit)
+	names := p.names()
+
+	switch req.Op {
+	case "add":
+		s.reject(p.unparsed)
+		s.truncate(p.truncated, limit)
+		s.add(names)
+	case "remove":
+		// any name can be removed, the limit is on what is added
+		s.remove(parsePaste(text, math.MaxInt).names())
+	case "sync":
+		s.reject(p.unparsed)
+		s.truncate(p.truncated, limit)
+		s.sync(names)
+	case "refresh":
+		s.refresh()
+	default:
+		s.send(liveMessage{Type: "error", Kind: kindInvalid, Message: fmt.Sprintf("unknown op %q", req.Op)})
+	}
+}
+
+// reject tells the client which names were not valid
+func (s *liveSession) reject(lines []unparsedLine) {
+	for _, l := range lines {
+		s.send(liveMessage{Type: "error", Name: strings.TrimSpace(l.Input), Kind: kindInvalid, Message: l.Reason})
+	}
+}
+
+// truncate tells the client which names were past the limit
+func (s *liveSession) truncate(jobs []lookupJob, limit int) {
+	for _, j := range jobs {
+		name := j.name
+		if name == "" {
+			name = strings.TrimSpace(j.input)
+		}
+		s.send(liveMessage{
+			Type:    "error",
+			Name:    name,
+			Kind:    kindTruncated,
+			Message: fmt.Sprintf("session is limited to %d names", limit),
+		})
+	}
+}
+
+func (s *liveSession) add(names []string) {
+	s.mu.Lock()
+	limit := s.settings.maxNames
+	jobs := make([]lookupJob, 0, len(names))
+	var dropped []string
+	for _, n := range names {
+		if _, ok := s.members[nameKey(n)]; ok {
+			continue
+		}
+		if len(s.members) >= limit {
+			dropped = append(dropped, n)
+			continue
+		}
+		s.members[nameKey(n)] = &liveMember{name: n}
+		jobs = append(jobs, lookupJob{name: n})
+	}
+	s.mu.Unlock()
+
+	for _, n := range dropped {
+		s.send(liveMessage{
+			Type:    "error",
+			Name:    n,
+			Kind:    kindTruncated,
+			Message: fmt.Sprintf("session is limited to %d names", limit),
+		})
+	}
+
+	if len(jobs) > 0 {
+		go s.fetch(jobs)
+	}
+}
+
+func (s *liveSession) remove(names []string) {
+	for _, n := range names {
+		s.mu.Lock()
+		m, ok := s.members[nameKey(n)]
+		delete(s.members, nameKey(n))
+		s.mu.Unlock()
+
+		// the client knows the member by the name it was added as
+		if ok {
+			s.send(liveMessage{Type: "remove", Name: m.name})
+		}
+	}
+}
+
+// sync diffs a complete list against the session
+func (s *liveSession) sync(names []string) {
+	keep := make(map[string]struct{}, len(names))
+	for _, n := range names {
+		keep[nameKey(n)] = struct{}{}
+	}
+
+	s.mu.Lock()
+	var gone []string
+	for key, m := range s.members {
+		if _, ok := keep[key]; !ok {
+			gone = append(gone, m.name)
+		}
+	}
+	s.mu.Unlock()
+
+	s.remove(gone)
+	s.add(names)
+}
+
+func (s *liveSession) refresh() {
+	s.mu.Lock()
+	jobs := make([]lookupJob, 0, len(s.members))
+	for _, m := range s.members {
+		// names still being fetched will be sent anyway
+		if m.fetched() {
+			jobs = append(jobs, lookupJob{name: m.name})
+		}
+	}
+	s.mu.Unlock()
+
+	if len(jobs) > 0 {
+		go s.fetch(jobs)
+	}
+}
+
+func (s *liveSession) fetch(jobs []lookupJob) {
+	s.mu.Lock()
+	ctx := withSettings(s.ctx, s.settings)
+	s.mu.Unlock()
+
+	for res := range lookupCharacters(ctx, jobs) {
+		name, key := res.job.name, nameKey(res.job.name)
+		// a corporation or alliance still has err say it isn't a character
+		failed := res.err != nil && res.entity == nil
+
+		s.mu.Lock()
+		m, ok := s.members[key]
+		fetched := ok && m.fetched()
+		if ok {
+			name = m.name
+		}
+		switch {
+		case !ok:
+			// removed while it was being fetched
+		case failed && !fetched:
+			// forget failed names so adding them again retries
+			delete(s.members, key)
+		case !failed:
+			m.row, m.entity = res.char, res.entity
+		}
+		s.mu.Unlock()
+
+		switch {
+		case !ok:
+		case failed:
+			log.WithError(res.err).Warn("live lookup failed")
+			s.send(liveMessage{Type: "error", Name: name, Kind: classifyError(res.err), Message: res.err.Error()})
+		case !fetched:
+			s.send(liveMessage{Type: "add", Name: name, Row: res.char, Entity: res.entity})
+		default:
+			s.send(liveMessage{Type: "update", Name: name, Row: res.char, Entity: res.entity})
+		}
+	}
+}
+
+// liveHandshake accepts same-origin browsers and clients that send no Origin
+func liveHandshake(config *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host != r.Host {
+		return fmt.Errorf("origin %q not allowed", origin)
+	}
+	config.Origin = u
+	return nil
+}
+
+// GET /info/live, a websocket session that follows a changing list of names
+var serveLive = websocket.Server{
+	Handshake: liveHandshake,
+	Handler:   liveHandler,
+}
+
+func liveHandler(ws *websocket.Conn) {
+	ws.MaxPayloadBytes = int(apiBodyLimit())
+
+	ctx, cancel := context.WithCancel(ws.Request().Context())
+	defer cancel()
+
+	s := newLiveSession(ctx)
+
+	// single writer, websocket frames must not interleave
+	go func() {
+		defer cancel()
+		for {
+			select {
+			case m := <-s.out:
+				data, err := json.Marshal(m)
+				if err != nil {
+					log.WithError(err).Warn("failed to encode live message")
+					continue
+				}
+				if err := websocket.Message.Send(ws, string(data)); err != nil {
+					log.WithError(err).Warn("live client disconnected")
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	log.Info("live session started")
+	defer log.Info("live session ended")
+
+	for {
+		var data []byte
+		if err := websocket.Message.Receive(ws, &data); err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.WithError(err).Warn("live receive failed")
+			}
+			return
+		}
+
+		var req liveRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			s.send(liveMessage{Type: "error", Kind: kindInvalid, Message: "invalid message"})
+			continue
+		}
+		s.handle(req)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+func dialLive(t *testing.T) *websocket.Conn {
+	t.Helper()
+
+	s := httptest.NewServer(newRouter())
+	t.Cleanup(s.Close)
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(s.URL, "http")+"/info/live", "", s.URL)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+func sendLive(t *testing.T, ws *websocket.Conn, req liveRequest) {
+	t.Helper()
+	if err := websocket.JSON.Send(ws, req); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+}
+
+// receiveLive reads n messages, keyed by type and name
+func receiveLive(t *testing.T, ws *websocket.Conn, n int) map[string]liveMessage {
+	t.Helper()
+
+	got := make(map[string]liveMessage, n)
+	_ = ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for i := 0; i < n; i++ {
+		var data []byte
+		if err := websocket.Message.Receive(ws, &data); err != nil {
+			t.Fatalf("receive %d failed: %v", i, err)
+		}
+		var m liveMessage
+		if err := json.Unmarshal(data, &m); err != nil {
+			t.Fatalf("bad message %q: %v", data, err)
+		}
+		got[m.Type+":"+m.Name] = m
+	}
+	return got
+}
+
+func TestLiveSession_Deltas(t *testing.T) {
+	fakeUpstream(t)
+	ws := dialLive(t)
+
+	sendLive(t, ws, liveRequest{Op: "add", Names: []string{"Mynxee", "Nobody", "Bad_Name"}})
+	got := receiveLive(t, ws, 3)
+	if m, ok := got["add:Mynxee"]; !ok || m.Row == nil || m.Row.CharacterID != 123 {
+		t.Fatalf("expected Mynxee to be added, got %v", got)
+	}
+	if m, ok := got["error:Nobody"]; !ok || m.Kind != kindNotFound {
+		t.Fatalf("expected Nobody to fail as not found, got %v", got)
+	}
+	if m, ok := got["error:Bad_Name"]; !ok || m.Kind != kindInvalid || m.Message == "" {
+		t.Fatalf("expected Bad_Name to be rejected, got %v", got)
+	}
+
+	// Mynxee is already in the session, only the removal should come back
+	sendLive(t, ws, liveRequest{Op: "add", Names: []string{"Mynxee"}})
+	sendLive(t, ws, liveRequest{Op: "remove", Names: []string{"Mynxee"}})
+	if got = receiveLive(t, ws, 1); len(got) != 1 || got["remove:Mynxee"].Type != "remove" {
+		t.Fatalf("expected only a remove, got %v", got)
+	}
+
+	// names match in any case, a second spelling is the same member
+	sendLive(t, ws, liveRequest{Op: "add", Names: []string{"Mynxee"}})
+	if got = receiveLive(t, ws, 1); got["add:Mynxee"].Row == nil {
+		t.Fatalf("expected Mynxee to be added again, got %v", got)
+	}
+	sendLive(t, ws, liveRequest{Op: "add", Names: []string{"mynxee"}})
+	sendLive(t, ws, liveRequest{Op: "remove", Names: []string{"MYNXEE"}})
+	if got = receiveLive(t, ws, 1); len(got) != 1 || got["remove:Mynxee"].Type != "remove" {
+		t.Fatalf("expected one remove of Mynxee as added, got %v", got)
+	}
+
+	sendLive(t, ws, liveRequest{Op: "sync", Names: []string{"Mynxee"}})
+	if got = receiveLive(t, ws, 1); got["add:Mynxee"].Row == nil {
+		t.Fatalf("expected sync to add Mynxee back, got %v", got)
+	}
+
+	sendLive(t, ws, liveRequest{Op: "refresh"})
+	if got = receiveLive(t, ws, 1); got["update:Mynxee"].Row == nil {
+		t.Fatalf("expected refresh to update Mynxee, got %v", got)
+	}
+
+	// a corporation is found, not reported missing
+	sendLive(t, ws, liveRequest{Op: "add", Names: []string{"TestCorp"}})
+	if got = receiveLive(t, ws, 1); got["add:TestCorp"].Entity == nil || got["add:TestCorp"].Entity.ID != 456 {
+		t.Fatalf("expected TestCorp to be added as a corporation, got %v", got)
+	}
+
+	sendLive(t, ws, liveRequest{Op: "bogus"})
+	if got = receiveLive(t, ws, 1); got["error:"].Kind != kindInvalid {
+		t.Fatalf("expected an invalid op error, got %v", got)
+	}
+}
+
+func TestLiveHandshake_RejectsForeignOrigin(t *testing.T) {
+	s := httptest.NewServer(newRouter())
+	defer s.Close()
+
+	_, err := websocket.Dial("ws"+strings.TrimPrefix(s.URL, "http")+"/info/live", "", "https://evil.example")
+	if err == nil {
+		t.Fatalf("expected a foreign origin to be rejected")
+	}
+}
+
+func TestLiveSession_Limit(t *testing.T) {
+	fakeUpstream(t)
+	ws := dialLive(t)
+
+	// names past the limit are reported rather than silently dropped
+	sendLive(t, ws, liveRequest{Op: "add", Names: []string{"Mynxee", "Nobody"}, Options: &lookupOptions{Limit: 1}})
+	got := receiveLive(t, ws, 2)
+	if got["add:Mynxee"].Row == nil {
+		t.Fatalf("expected Mynxee to be added, got %v", got)
+	}
+	if m, ok := got["error:Nobody"]; !ok || m.Kind != kindTruncated {
+		t.Fatalf("expected Nobody to be truncated, got %v", got)
+	}
+
+	// removing isn't limited, Mynxee is second and still goes
+	sendLive(t, ws, liveRequest{Op: "remove", Names: []string{"Nobody", "Mynxee"}})
+	if got = receiveLive(t, ws, 1); got["remove:Mynxee"].Type != "remove" {
+		t.Fatalf("expected Mynxee to be removed, got %v", got)
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	cache "zgo.at/zcache/v2"
+)
+
+// systems and regions returned for a character
+const topLocations = 5
+
+// wormhole systems are numbered apart from known space
+const (
+	firstWormholeSystem = 31000000
+	lastWormholeSystem  = 31999999
+)
+
+// kinds of space, by security status
+const (
+	spaceHigh     = "high_sec"
+	spaceLow      = "low_sec"
+	spaceNull     = "null_sec"
+	spaceWormhole = "wormhole"
+)
+
+// systemInfo is a solar system with its constellation and region
+type systemInfo struct {
+	ID                int
+	Name              string
+	Security          float64
+	ConstellationID   int
+	ConstellationName string
+	RegionID          int
+	RegionName        string
+}
+
+// space tells high, low and null sec apart as the game does, rounding the
+// security status to one decimal except that anything above 0 is low sec
+func (s systemInfo) space() string {
+	switch {
+	case s.ID >= firstWormholeSystem && s.ID <= lastWormholeSystem:
+		return spaceWormhole
+	case s.Security >= 0.45:
+		return spaceHigh
+	case s.Security > 0:
+		return spaceLow
+	}
+	return spaceNull
+}
+
+// systemCount is a system a character was seen in, Count killmails
+type systemCount struct {
+	ID            int     `json:"id"`
+	Name          string  `json:"name"`
+	Security      float64 `json:"security"`
+	Constellation string  `json:"constellation"`
+	Region        string  `json:"region"`
+	Count         int     `json:"count"`
+}
+
+// regionCount is a region a character was seen in, Count killmails
+type regionCount struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// spaceShare is the percentage of killmails in each kind of space
+type spaceShare struct {
+	HighSec  int `json:"high_sec"`
+	LowSec   int `json:"low_sec"`
+	NullSec  int `json:"null_sec"`
+	Wormhole int `json:"wormhole"`
+}
+
+// locationData is where a character is seen on killmails, the systems and
+// regions most seen first. Samples counts the killmails whose system could
+// be resolved.
+type locationData struct {
+	Systems []systemCount `json:"systems"`
+	Regions []regionCount `json:"regions"`
+	Space   spaceShare    `json:"space"`
+	Samples int           `json:"samples"`
+}
+
+// fetchLocations resolves the systems of a character's killmails and
+// tallies them, nil when none could be resolved
+func fetchLocations(ctx context.Context, systemIDs []int) *locationData {
+	systems := resolveSystems(ctx, systemIDs)
+
+	bySystem := make(map[int]*systemCount)
+	byRegion := make(map[int]*regionCount)
+	bySpace := make(map[string]int)
+	samples := 0
+
+	for _, id := range systemIDs {
+		s, ok := systems[id]
+		if !ok {
+			continue
+		}
+		samples++
+		bySpace[s.space()]++
+
+		sc, ok := bySystem[id]
+		if !ok {
+			sc = &systemCount{
+				ID:            id,
+				Name:          s.Name,
+				Security:      round2(s.Security),
+				Constellation: s.ConstellationName,
+				Region:        s.RegionName,
+			}
+			bySystem[id] = sc
+		}
+		sc.Count++
+
+		rc, ok := byRegion[s.RegionID]
+		if !ok {
+			rc = &regionCount{ID: s.RegionID, Name: s.RegionName}
+			byRegion[s.RegionID] = rc
+		}
+		rc.Count++
+	}
+	if samples == 0 {
+		return nil
+	}
+
+	ld := locationData{Samples: samples}
+	for _, sc := range bySystem {
+		ld.Systems = append(ld.Systems, *sc)
+	}
+	slices.SortFunc(ld.Systems, func(a, b systemCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Name, b.Name))
+	})
+	ld.Systems = ld.Systems[:min(len(ld.Systems), topLocations)]
+
+	for _, rc := range byRegion {
+		ld.Regions = append(ld.Regions, *rc)
+	}
+	slices.SortFunc(ld.Regions, func(a, b regionCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Name, b.Name))
+	})
+	ld.Regions = ld.Regions[:min(len(ld.Regions), topLocations)]
+
+	share := func(space string) int { return bySpace[space] * 100 / samples }
+	ld.Space = spaceShare{
+		HighSec:  share(spaceHigh),
+		LowSec:   share(spaceLow),
+		NullSec:  share(spaceNull),
+		Wormhole: share(spaceWormhole),
+	}
+
+	return &ld
+}
+
+// resolveSystems looks up every distinct system, leaving out those that
+// can't be resolved
+func resolveSystems(ctx context.Context, ids []int) map[int]systemInfo {
+	systems := make(map[int]systemInfo)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxWorkers)
+
+	seen := make(map[int]bool)
+	for _, id := range ids {
+		if id == 0 || seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(id int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			s, err := fetchSystemInfo(ctx, id)
+			if err != nil {
+				log.WithError(err).WithField("system", id).Debug("system lookup failed")
+				return
+			}
+
+			mu.Lock()
+			systems[id] = s
+			mu.Unlock()
+		}(id)
+	}
+	wg.Wait()
+
+	return systems
+}
+
+// fetchSystemInfo resolves a system, its constellation and its region. Like
+// types they never change so every part is cached for good.
+func fetchSystemInfo(ctx context.Context, id int) (systemInfo, error) {
+	key := fmt.Sprint("system:", id)
+	if rec, found := ccpCache.Get(key); found {
+		return rec.(systemInfo), nil
+	}
+
+	var s struct {
+		Name            string  `json:"name"`
+		Security        float64 `json:"security_status"`
+		ConstellationID int     `json:"constellation_id"`
+	}
+	if err := ccpGetStatic(ctx, fmt.Sprintf("universe/systems/%d/", id), &s); err != nil {
+		return systemInfo{}, err
+	}
+
+	c, err := fetchConstellationInfo(ctx, s.ConstellationID)
+	if err != nil {
+		return systemInfo{}, err
+	}
+
+	si := systemInfo{
+		ID:                id,
+		Name:              s.Name,
+		Security:          s.Security,
+		ConstellationID:   s.ConstellationID,
+		ConstellationName: c.Name,
+		RegionID:          c.RegionID,
+		RegionName:        c.RegionName,
+	}
+
+	ccpCache.SetWithExpire(key, si, cache.NoExpiration)
+
+	return si, nil
+}
+
+type constellationInfo struct {
+	Name       string
+	RegionID   int
+	RegionName string
+}
+
+func fetchConstellationInfo(ctx context.Context, id int) (constellationInfo, error) {
+	key := fmt.Sprint("constellation:", id)
+	if rec, found := ccpCache.Get(key); found {
+		return rec.(constellationInfo), nil
+	}
+
+	var c struct {
+		Name     string `json:"name"`
+		RegionID int    `json:"region_id"`
+	}
+	if err := ccpGetStatic(ctx, fmt.Sprintf("universe/constellations/%d/", id), &c); err != nil {
+		return constellationInfo{}, err
+	}
+
+	regionKey := fmt.Sprint("region:", c.RegionID)
+	regionName, found := ccpCache.Get(regionKey)
+	if !found {
+		var r struct {
+			Name string `json:"name"`
+		}
+		if err := ccpGetStatic(ctx, fmt.Sprintf("universe/regions/%d/", c.RegionID), &r); err != nil {
+			return constellationInfo{}, err
+		}
+		regionName = r.Name
+		ccpCache.SetWithExpire(regionKey, regionName, cache.NoExpiration)
+	}
+
+	ci := constellationInfo{Name: c.Name, RegionID: c.RegionID, RegionName: regionName.(string)}
+	ccpCache.SetWithExpire(key, ci, cache.NoExpiration)
+
+	return ci, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cache "zgo.at/zcache/v2"
+)
+
+func TestFetchLocations(t *testing.T) {
+	ccpCache = cache.New[string, any](1*time.Hour, 10*time.Minute)
+
+	systems := map[int]map[string]any{
+		30000142: {"name": "Jita", "security_status": 0.946, "constellation_id": 20000020},
+		30000144: {"name": "Perimeter", "security_status": 0.95, "constellation_id": 20000020},
+		30002813: {"name": "Tama", "security_status": 0.3, "constellation_id": 20000410},
+		30004759: {"name": "1DQ1-A", "security_status": -0.38, "constellation_id": 20000696},
+		31000005: {"name": "Thera", "security_status": -1, "constellation_id": 21000324},
+	}
+	constellations := map[int]map[string]any{
+		20000020: {"name": "Kimotoro", "region_id": 10000002},
+		20000410: {"name": "Okakuola", "region_id": 10000033},
+		20000696: {"name": "O-EIMK", "region_id": 10000060},
+		21000324: {"name": "Thera", "region_id": 11000031},
+	}
+	regions := map[int]string{10000002: "The Forge", 10000033: "The Citadel", 10000060: "Delve", 11000031: "G-R00031"}
+
+	var calls atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		var id int
+		switch {
+		case sscan(r.URL.Path, "/universe/systems/%d/", &id) && systems[id] != nil:
+			_ = json.NewEncoder(w).Encode(systems[id])
+		case sscan(r.URL.Path, "/universe/constellations/%d/", &id) && constellations[id] != nil:
+			_ = json.NewEncoder(w).Encode(constellations[id])
+		case sscan(r.URL.Path, "/universe/regions/%d/", &id) && regions[id] != "":
+			_ = json.NewEncoder(w).Encode(map[string]any{"name": regions[id]})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+
+	orig := ccpEsiURL
+	ccpEsiURL = s.URL + "/"
+	defer func() { ccpEsiURL = orig }()
+
+	// 30099999 can't be resolved and 0 is a killmail without a system
+	ids := []int{30000142, 30000142, 30000142, 30000144, 30002813, 30004759, 31000005, 30099999, 0}
+	ld := fetchLocations(context.Background(), ids)
+	if ld == nil {
+		t.Fatal("expected locations")
+	}
+	if ld.Samples != 7 {
+		t.Errorf("samples = %d, want 7", ld.Samples)
+	}
+
+	if ld.Systems[0] != (systemCount{ID: 30000142, Name: "Jita", Security: 0.95, Constellation: "Kimotoro", Region: "The Forge", Count: 3}) {
+		t.Errorf("top system = %+v", ld.Systems[0])
+	}
+	if len(ld.Systems) != topLocations {
+		t.Errorf("got %d systems, want %d", len(ld.Systems), topLocations)
+	}
+
+	wantRegions := []regionCount{
+		{ID: 10000002, Name: "The Forge", Count: 4},
+		{ID: 10000060, Name: "Delve", Count: 1},
+		{ID: 11000031, Name: "G-R00031", Count: 1},
+		{ID: 10000033, Name: "The Citadel", Count: 1},
+	}
+	if !slices.Equal(ld.Regions, wantRegions) {
+		t.Errorf("regions = %+v, want %+v", ld.Regions, wantRegions)
+	}
+
+	if want := (spaceShare{HighSec: 57, LowSec: 14, NullSec: 14, Wormhole: 14}); ld.Space != want {
+		t.Errorf("space = %+v, want %+v", ld.Space, want)
+	}
+
+	// systems, constellations and regions are cached for good
+	before := calls.Load()
+	fetchLocations(context.Background(), []int{30000142, 30004759})
+	if calls.Load() != before {
+		t.Errorf("expected cached systems, got %d more calls", calls.Load()-before)
+	}
+}
+
+func TestFetchLocations_None(t *testing.T) {
+	if ld := fetchLocations(context.Background(), []int{0, 0}); ld != nil {
+		t.Errorf("expected no locations, got %+v", ld)
+	}
+}
+
+func TestSystemInfo_Space(t *testing.T) {
+	tests := []struct {
+		system systemInfo
+		want   string
+	}{
+		{systemInfo{ID: 30000142, Security: 0.946}, spaceHigh},
+		{systemInfo{ID: 1, Security: 0.45}, spaceHigh},
+		{systemInfo{ID: 1, Security: 0.449}, spaceLow},
+		{systemInfo{ID: 1, Security: 0.01}, spaceLow},
+		{systemInfo{ID: 1, Security: 0}, spaceNull},
+		{systemInfo{ID: 1, Security: -0.5}, spaceNull},
+		{systemInfo{ID: 31000005, Security: -1}, spaceWormhole},
+	}
+
+	for _, tt := range tests {
+		if got := tt.system.space(); got != tt.want {
+			t.Errorf("space of %+v = %s, want %s", tt.system, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// names of the records produced by streamLookup, corporations and alliances
+// are sent as entityCorporation and entityAlliance records
+const (
+	eventStart     = "start"
+	eventCharacter = "character"
+	eventError     = "error"
+	eventProgress  = "progress"
+	eventDone      = "done"
+)
+
+var newlineRegex = regexp.MustCompile(`\r?\n|\r`)
+
+// a single unit of work for the lookup pipeline, either a name to resolve or
+// an already known character id. index and input point back at the line of
+// the paste the job came from.
+type lookupJob struct {
+	index int
+	input string
+	name  string
+	id    int
+	// "corporation" or "alliance" when id is a pasted corporation or alliance
+	entity string
+	// set for members of a pasted fleet
+	fleet *fleetMember
+	// a pasted kill, expandLinks replaces it with the characters involved
+	killmail *killLink
+	// the role of the character on a pasted kill
+	kill *killInvolvement
+}
+
+// lookupResult pairs a job with what fetching it produced, pos is the
+// position of the job in the list given to lookupCharacters. entity is set
+// when the job was a corporation or alliance, err then still says the
+// character wasn't found for callers that only want characters.
+type lookupResult struct {
+	pos int
+	job lookupJob
+	*characterResponse
+	entity *entityData
+}
+
+// stamp copies the position of the job, and what else the paste said about
+// the character, onto the character
+func (r lookupResult) stamp() {
+	if r.entity != nil {
+		r.entity.Index = r.job.index
+		r.entity.Input = r.job.input
+	}
+	if r.char != nil {
+		r.char.Index = r.job.index
+		r.char.Input = r.job.input
+		r.char.Fleet = r.job.fleet
+		r.char.Kill = r.job.kill
+	}
+}
+
+// truncatedResult is the failed result of a job left out because the lookup
+// reached its limit of names
+func truncatedResult(job lookupJob, limit int) lookupResult {
+	name := job.name
+	if name == "" {
+		name = job.input
+	}
+	err := &lookupError{
+		Name: name,
+		ID:   job.id,
+		Kind: kindTruncated,
+		Err:  fmt.Errorf("lookup is limited to %d names", limit),
+	}
+	return lookupResult{job: job, characterResponse: &characterResponse{nil, err}}
+}
+
+// unparsedResult is the failed result of a pasted line that isn't a name
+func unparsedResult(l unparsedLine) lookupResult {
+	err := &lookupError{
+		Name: strings.TrimSpace(l.Input),
+		Kind: kindInvalid,
+		Err:  errors.New(l.Reason),
+	}
+	job := lookupJob{index: l.Index, input: l.Input}
+	return lookupResult{job: job, characterResponse: &characterResponse{nil, err}}
+}
+
+// errorRecord is the stream record of a failed result
+func (r lookupResult) errorRecord() map[string]any {
+	rec := errorRecord(r.err)
+	rec["index"] = r.job.index
+	rec["input"] = r.job.input
+	if r.job.kill != nil {
+		rec["kill"] = r.job.kill
+	}
+	if r.job.name != "" && classifyError(r.err) == kindNotFound {
+		if s := knownNames.suggest(r.job.name, errorSuggestions); len(s) > 0 {
+			rec["suggestions"] = s
+		}
+	}
+	return rec
+}
+
+func (j lookupJob) fetch(ctx context.Context) *characterResponse {
+	if j.id != 0 {
+		return fetchCharacterDataByID(ctx, j.id)
+	}
+	return fetchCharacterData(ctx, j.name)
+}
+
+// lookup fetches the job. A name that universe/ids/ knows as a corporation or
+// alliance, and a pasted corporation or alliance link, fetch the entity too.
+func (j lookupJob) lookup(ctx context.Context, pos int) lookupResult {
+	res := lookupResult{pos: pos, job: j}
+
+	kind, id := j.entity, j.id
+	if kind == "" {
+		res.characterResponse = j.fetch(ctx)
+		if res.err == nil || j.name == "" || classifyError(res.err) != kindNotFound {
+			return res
+		}
+		var ok bool
+		if kind, id, ok = lookupEntityID(j.name); !ok {
+			return res
+		}
+	} else {
+		// there is no character to resolve, the id is known already
+		progressFrom(ctx).finish(phaseIDs)
+		err := fmt.Errorf("%w, %s %d is not a character", errNotFound, kind, id)
+		res.characterResponse = &characterResponse{nil, newLookupError(j.input, id, err)}
+	}
+
+	ent, err := fetchEntity(ctx, kind, id)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{kind: id}).Warn("entity lookup failed")
+		res.characterResponse = &characterResponse{nil, newLookupError(j.input, id, err)}
+		return res
+	}
+	res.entity = ent
+
+	return res
+}
+
+// parseInput splits pasted text into jobs of de-duplicated names, stopping at
+// limit entries. Each job remembers its line number and the line as pasted.
+// See parsePaste for the formats understood.
+func parseInput(text string, limit int) []lookupJob {
+	return parsePaste(text, limit).jobs
+}
+
+// parseNames is parseInput for callers that only want the names, links are
+// dropped
+func parseNames(text string, limit int) []string {
+	return parsePaste(text, limit).names()
+}
+
+func nameJobs(names []string) []lookupJob {
+	jobs := make([]lookupJob, 0, len(names))
+	for i, n := range names {
+		jobs = append(jobs, lookupJob{index: i, input: n, name: n})
+	}
+	return jobs
+}
+
+// lookupCharacters runs the jobs through a pool of maxWorkers goroutines and
+// returns a channel of results in completion order. The channel is closed
+// once every job has finished or ctx is cancelled.
+func lookupCharacters(ctx context.Context, jobs []lookupJob) <-chan lookupResult {
+	names := make([]string, 0, len(jobs))
+	for _, j := range jobs {
+		if j.id == 0 {
+			names = append(names, j.name)
+		}
+	}
+
+	if len(names) > 0 {
+		if ok, err := loadCharacterIds(ctx, names); !ok {
+			log.WithError(err).Warn("failed to preload character IDs")
+		}
+	}
+
+	type queued struct {
+		pos int
+		job lookupJob
+	}
+
+	queue := make(chan queued)
+	results := make(chan lookupResult, maxWorkers)
+
+	var wg sync.WaitGroup
+
+	// workers
+	for i := 0; i < maxWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for q := range queue {
+				select {
+				case results <- q.job.lookup(ctx, q.pos):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	// feed jobs
+	go func() {
+		defer close(queue)
+		for pos, job := range jobs {
+			select {
+			case queue <- queued{pos, job}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// close results
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
+
+// orderResults re-sequences results into job order, holding back anything
+// that finishes before the jobs ahead of it
+func orderResults(ctx context.Context, in <-chan lookupResult) <-chan lookupResult {
+	out := make(chan lookupResult)
+
+	go func() {
+		defer close(out)
+
+		pending := make(map[int]lookupResult)
+		next := 0
+		for res := range in {
+			pending[res.pos] = res
+			for {
+				r, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				select {
+				case out <- r:
+				case <-ctx.Done():
+					return
+				}
+				next++
+			}
+		}
+	}()
+
+	return out
+}
+
+// streamLookup runs the jobs through lookupCharacters and hands every record
+// of the lookup stream to emit: a start record, one character or error record
+// per job, progress records while work advances and a final done record.
+// Records are numbered by seq in the order they are emitted, character and
+// error records also carry the index and input of their job. Results come in
+// completion order unless the lookup settings ask for ordered output.
+// It stops at the first error returned by emit.
+func streamLookup(ctx context.Context, p paste, emit func(event string, rec any) error) error {
+	seq := 0
+	emitSeq := func(event string, rec any) error {
+		seq++
+		switch r := rec.(type) {
+		case map[string]any:
+			r["seq"] = seq
+		case *characterData:
+			r.Seq = seq
+		case *entityData:
+			r.Seq = seq
+		}
+		return emit(event, rec)
+	}
+
+	settings := settingsFrom(ctx)
+	ordered := settings.ordered
+
+	// pasted kills are expanded up front so the total is known at the start.
+	// Kills that can't be fetched and names past the limit are reported as
+	// failures before any lookup.
+	jobs, failures := expandLinks(ctx, p.jobs, settings.maxNames)
+	for _, job := range p.truncated {
+		failures = append(failures, truncatedResult(job, settings.maxNames))
+	}
+	total := len(jobs) + len(failures)
+
+	truncated := 0
+	for _, f := range failures {
+		if classifyError(f.err) == kindTruncated {
+			truncated++
+		}
+	}
+
+	if err := emitSeq(eventStart, map[string]any{
+		"_meta":     eventStart,
+		"total":     total,
+		"ordered":   ordered,
+		"format":    p.format,
+		"unparsed":  p.unparsed,
+		"truncated": truncated,
+	}); err != nil {
+		return err
+	}
+
+	progress := newLookupProgress(len(jobs))
+	results := lookupCharacters(withProgress(ctx, progress), jobs)
+	if ordered {
+		results = orderResults(ctx, results)
+	}
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	sent := 0
+	failed := 0
+	var chars []*characterData
+	var entities []*entityData
+
+	for _, resp := range failures {
+		failed++
+		if err := emitSeq(eventError, resp.errorRecord()); err != nil {
+			return err
+		}
+	}
+
+	for results != nil {
+		var (
+			event string
+			rec   any
+		)
+
+		select {
+		case resp, ok := <-results:
+			if !ok {
+				results = nil
+				continue
+			}
+			if resp.entity != nil {
+				sent++
+				resp.stamp()
+				entities = append(entities, resp.entity)
+				event, rec = resp.entity.Kind, resp.entity
+			} else if resp.err != nil {
+				log.WithError(resp.err).Error("fetch failed")
+				failed++
+				event, rec = eventError, resp.errorRecord()
+			} else {
+				sent++
+				resp.stamp()
+				chars = append(chars, resp.char)
+				event, rec = eventCharacter, resp.char
+			}
+		case <-ticker.C:
+			if !progress.changed() {
+				continue
+			}
+			event, rec = eventProgress, progress.record(sent, failed)
+		}
+
+		if err := emitSeq(event, rec); err != nil {
+			return err
+		}
+	}
+
+	done := map[string]any{
+		"_meta":  eventDone,
+		"sent":   sent,
+		"failed": failed,
+		"total":  total,
+	}
+
+	// only a lookup that ran to the end is worth sharing
+	if settings.save && len(chars)+len(entities) > 0 && ctx.Err() == nil {
+		if snap, err := saveSnapshot(chars, entities); err != nil {
+			log.WithError(err).Warn("failed to save snapshot")
+		} else {
+			done["snapshot"] = snap.ID
+			done["url"] = "/r/" + snap.ID
+		}
+	}
+
+	return emitSeq(eventDone, done)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseInput(t *testing.T) {
+	jobs := parseInput("  Mynxee\r\nab\n\nPortia Tigana\nMynxee\nThird One", 2)
+
+	if len(jobs) != 2 {
+		t.Fatalf("expected the limit to stop at 2 jobs, got %v", jobs)
+	}
+	want := []lookupJob{
+		{index: 0, input: "  Mynxee", name: "Mynxee"},
+		{index: 3, input: "Portia Tigana", name: "Portia Tigana"},
+	}
+	for i, j := range jobs {
+		if j != want[i] {
+			t.Fatalf("job %d = %+v; want %+v", i, j, want[i])
+		}
+	}
+
+	if names := parseNames("Mynxee\nMynxee\nab", 10); len(names) != 1 || names[0] != "Mynxee" {
+		t.Fatalf("unexpected names %v", names)
+	}
+}
+
+func TestOrderResults(t *testing.T) {
+	in := make(chan lookupResult)
+	out := orderResults(context.Background(), in)
+
+	go func() {
+		for _, pos := range []int{2, 0, 3, 1} {
+			in <- lookupResult{pos: pos}
+		}
+		close(in)
+	}()
+
+	next := 0
+	for r := range out {
+		if r.pos != next {
+			t.Fatalf("expected position %d, got %d", next, r.pos)
+		}
+		next++
+	}
+	if next != 4 {
+		t.Fatalf("expected 4 results, got %d", next)
+	}
+}
+
+func TestStreamLookup_OrderedAndNumbered(t *testing.T) {
+	fakeUpstream(t)
+
+	p := parsePaste("Nobody\nMynxee\nSomebody", 10)
+	ctx := withSettings(context.Background(), lookupOptions{Ordered: true}.settings())
+
+	var events []string
+	var records []any
+	err := streamLookup(ctx, p, func(event string, rec any) error {
+		if event != eventProgress {
+			events = append(events, event)
+			records = append(records, rec)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	want := []string{eventStart, eventError, eventCharacter, eventError, eventDone}
+	if len(events) != len(want) {
+		t.Fatalf("expected events %v, got %v", want, events)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Fatalf("expected events %v, got %v", want, events)
+		}
+	}
+
+	lastSeq := 0
+	for i, rec := range records {
+		var seq, index int
+		var input string
+		switch r := rec.(type) {
+		case *characterData:
+			seq, index, input = r.Seq, r.Index, r.Input
+		case map[string]any:
+			seq = r["seq"].(int)
+			if i > 0 && i < len(records)-1 {
+				index, input = r["index"].(int), r["input"].(string)
+			}
+		}
+		if seq <= lastSeq {
+			t.Fatalf("record %d has seq %d after %d", i, seq, lastSeq)
+		}
+		lastSeq = seq
+		if i > 0 && i < len(records)-1 && (index != i-1 || input != p.jobs[i-1].input) {
+			t.Fatalf("record %d has index %d input %q", i, index, input)
+		}
+	}
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openAPIDoc is static/openapi.json with just enough of JSON Schema to check
+// responses against it: $ref, allOf, oneOf, enum, type, required, properties,
+// additionalProperties, items and the date-time format
+type openAPIDoc map[string]any
+
+func loadOpenAPI(t *testing.T) openAPIDoc {
+	t.Helper()
+
+	data, err := os.ReadFile("static/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc openAPIDoc
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+	if doc["openapi"] != "3.0.3" {
+		t.Fatalf("unexpected openapi version %v", doc["openapi"])
+	}
+	return doc
+}
+
+// resolve follows $ref until it reaches an object without one
+func (d openAPIDoc) resolve(node map[string]any) map[string]any {
+	for {
+		ref, ok := node["$ref"].(string)
+		if !ok {
+			return node
+		}
+		var cur any = map[string]any(d)
+		for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			cur = cur.(map[string]any)[part]
+		}
+		node = cur.(map[string]any)
+	}
+}
+
+func (d openAPIDoc) schema(name string) map[string]any {
+	return d["components"].(map[string]any)["schemas"].(map[string]any)[name].(map[string]any)
+}
+
+// responseSchema is the JSON schema of a documented response
+func (d openAPIDoc) responseSchema(path, method string, status int) (map[string]any, error) {
+	op, ok := d["paths"].(map[string]any)[path].(map[string]any)[method].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s %s is not documented", method, path)
+	}
+	resp, ok := op["responses"].(map[string]any)[fmt.Sprint(status)].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s %s does not document status %d", method, path, status)
+	}
+	resp = d.resolve(resp)
+	media, ok := resp["content"].(map[string]any)["application/json"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s %s %d has no JSON content", method, path, status)
+	}
+	return media["schema"].(map[string]any), nil
+}
+
+func (d openAPIDoc) validate(schema map[string]any, v any, at string) error {
+	schema = d.resolve(schema)
+
+	if all, ok := schema["allOf"].([]any); ok {
+		for _, s := range all {
+			if err := d.validate(s.(map[string]any), v, at); err != nil {
+				return err
+			}
+		}
+	}
+
+	if one, ok := schema["oneOf"].([]any); ok {
+		matched := 0
+		var errs []string
+		for _, s := range one {
+			if err := d.validate(s.(map[string]any), v, at); err != nil {
+				errs = append(errs, err.Error())
+				continue
+			}
+			matched++
+		}
+		if matched != 1 {
+			return fmt.Errorf("%s: matched %d of oneOf: %s", at, matched, strings.Join(errs, "; "))
+		}
+	}
+
+	if enum, ok := schema["enum"].([]any); ok && !slices.Contains(enum, v) {
+		return fmt.Errorf("%s: %v not in %v", at, v, enum)
+	}
+
+	switch schema["type"] {
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: expected object, got %T", at, v)
+		}
+		for _, r := range asSlice(schema["required"]) {
+			if _, ok := obj[r.(string)]; !ok {
+				return fmt.Errorf("%s: missing required %q", at, r)
+			}
+		}
+		props, _ := schema["properties"].(map[string]any)
+		for k, fv := range obj {
+			if ps, ok := props[k].(map[string]any); ok {
+				if err := d.validate(ps, fv, at+"."+k); err != nil {
+					return err
+				}
+				continue
+			}
+			switch ap := schema["additionalProperties"].(type) {
+			case bool:
+				if !ap {
+					return fmt.Errorf("%s: unexpected property %q", at, k)
+				}
+			case map[string]any:
+				if err := d.validate(ap, fv, at+"."+k); err != nil {
+					return err
+				}
+			}
+		}
+	case "array":
+		arr, ok := v.([]any)
+		if !ok {
+			return fmt.Errorf("%s: expected array, got %T", at, v)
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range arr {
+				if err := d.validate(items, item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case "string":
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s: expected string, got %T", at, v)
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				return fmt.Errorf("%s: %q is not a date-time", at, s)
+			}
+		}
+	case "integer":
+		if n, ok := v.(float64); !ok || n != float64(int64(n)) {
+			return fmt.Errorf("%s: expected integer, got %v", at, v)
+		}
+	case "number":
+		if _, ok := v.(float64); !ok {
+			return fmt.Errorf("%s: expected number, got %T", at, v)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s: expected boolean, got %T", at, v)
+		}
+	}
+
+	return nil
+}
+
+func asSlice(v any) []any {
+	s, _ := v.([]any)
+	return s
+}
+
+// roundTrip turns a server value into what a client decodes
+func roundTrip(t *testing.T, v any) any {
+	t.Helper()
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out any
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// every field in data.go must be documented, and only fields that are always
+// sent may be required
+func TestOpenAPI_CharacterDataFields(t *testing.T) {
+	doc := loadOpenAPI(t)
+	schema := doc.schema("CharacterData")
+	props := schema["properties"].(map[string]any)
+	required := asSlice(schema["required"])
+
+	fields := map[string]bool{}
+	typ := reflect.TypeOf(characterData{})
+	for i := range typ.NumField() {
+		if !typ.Field(i).IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		fields[name] = true
+
+		if _, ok := props[name]; !ok {
+			t.Errorf("field %s (%s) is missing from the CharacterData schema", typ.Field(i).Name, name)
+		}
+		if isRequired := slices.Contains(required, any(name)); isRequired == (opts == "omitempty") {
+			t.Errorf("field %s: required is %v but omitempty is %v", name, isRequired, opts == "omitempty")
+		}
+	}
+
+	for name := range props {
+		if !fields[name] {
+			t.Errorf("schema property %s is not a field of characterData", name)
+		}
+	}
+}
+
+func TestOpenAPI_StreamRecords(t *testing.T) {
+	fakeUpstream(t)
+	useSnapshotStore(t)
+	doc := loadOpenAPI(t)
+	record := doc.schema("StreamRecord")
+
+	form := url.Values{"characters": {"Mynxee\nNobody\nTestCorp\nTest Alliance"}, "save": {"true"}}
+	req := httptest.NewRequest(http.MethodPost, "/info", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	newRouter().ServeHTTP(rec, req)
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	seen := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimSpace(rec.Body.String()), "\n") {
+		var v map[string]any
+		if err := json.Unmarshal([]byte(line), &v); err != nil {
+			t.Fatalf("bad record %q: %v", line, err)
+		}
+		if err := doc.validate(record, v, "record"); err != nil {
+			t.Errorf("%v\n%s", err, line)
+		}
+		kind, _ := v["_meta"].(string)
+		seen[kind] = true
+	}
+	for _, kind := range []string{"", "start", "error", "corporation", "alliance", "done"} {
+		if !seen[kind] {
+			t.Errorf("no %q record in the stream", kind)
+		}
+	}
+
+	// progress records depend on timing, check one directly
+	p := newLookupProgress(2)
+	p.expect(phaseCCP)
+	progress := roundTrip(t, withSeq(p.record(1, 0)))
+	if err := doc.validate(record, progress, "progress"); err != nil {
+		t.Error(err)
+	}
+}
+
+// withSeq adds the seq streamLookup stamps on every record
+func withSeq(rec map[string]any) map[string]any {
+	rec["seq"] = 1
+	return rec
+}
+
+func TestOpenAPI_JSONResponses(t *testing.T) {
+	fakeUpstream(t)
+	useSnapshotStore(t)
+	doc := loadOpenAPI(t)
+	router := newRouter()
+
+	snap, err := saveSnapshot([]*characterData{{Name: "Space Mom", CharacterID: 123, Birthday: "2000-01-01T00:00:00Z"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method, path, body string
+		spec               string
+		wantStatus         int
+	}{
+		{"GET", "/api/v1/characters/Mynxee", "", "/api/v1/characters/{character}", 200},
+		{"GET", "/api/v1/characters/123", "", "/api/v1/characters/{character}", 200},
+		{"GET", "/api/v1/characters/Nobody", "", "/api/v1/characters/{character}", 404},
+		{"GET", "/api/v1/characters/ab", "", "/api/v1/characters/{character}", 400},
+		{"GET", "/api/v1/characters/500", "", "/api/v1/characters/{character}", 502},
+		{"POST", "/api/v1/lookups", `{"names": ["Mynxee"], "ids": [123]}`, "/api/v1/lookups", 200},
+		{"POST", "/api/v1/lookups", `{"names": ["TestCorp", "x@@y", "Mynxee", "Nobody"], "options": {"limit": 2}}`, "/api/v1/lookups", 200},
+		{"POST", "/api/v1/lookups", `{"names": [`, "/api/v1/lookups", 400},
+		{"GET", "/api/v1/snapshots/" + snap.ID, "", "/api/v1/snapshots/{id}", 200},
+		{"GET", "/api/v1/snapshots/ZZZZZZZZ", "", "/api/v1/snapshots/{id}", 404},
+		{"GET", "/api/v1/suggest?q=myn", "", "/api/v1/suggest", 200},
+		{"GET", "/api/v1/suggest", "", "/api/v1/suggest", 400},
+		{"GET", "/health", "", "/health", 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+				t.Fatalf("unexpected content type %q", ct)
+			}
+
+			schema, err := doc.responseSchema(tt.spec, strings.ToLower(tt.method), rec.Code)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var v any
+			if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+				t.Fatalf("bad body %q: %v", rec.Body.String(), err)
+			}
+			if err := doc.validate(schema, v, "body"); err != nil {
+				t.Fatalf("%v\n%s", err, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestOpenAPI_LiveMessages(t *testing.T) {
+	doc := loadOpenAPI(t)
+	schema := doc.schema("LiveMessage")
+
+	for _, m := range []liveMessage{
+		{Type: "add", Name: "Mynxee", Row: &characterData{Name: "Space Mom", Index: 1}},
+		{Type: "add", Name: "TestCorp", Entity: &entityData{Kind: entityCorporation, ID: 456, Name: "TestCorp", Ticker: "TEST"}},
+		{Type: "remove", Name: "Mynxee"},
+		{Type: "error", Name: "Nobody", Kind: kindNotFound, Message: "not found"},
+	} {
+		if err := doc.validate(schema, roundTrip(t, m), m.Type); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// documented paths must reach a handler of their own rather than the index
+// page, and the document itself must be served
+func TestOpenAPI_PathsAreRouted(t *testing.T) {
+	doc := loadOpenAPI(t)
+	router := newRouter()
+
+	for path, item := range doc["paths"].(map[string]any) {
+		for method := range item.(map[string]any) {
+			concrete := strings.NewReplacer("{id}", "ABCDEFGH", "{character}", "Mynxee").Replace(path)
+			req := httptest.NewRequest(strings.ToUpper(method), concrete, nil)
+			if _, pattern := router.Handler(req); pattern == "/" || pattern == "" {
+				t.Errorf("%s %s is documented but not routed", strings.ToUpper(method), path)
+			}
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rec.Code != http.StatusOK || !bytes.Contains(rec.Body.Bytes(), []byte(`"openapi"`)) {
+		t.Fatalf("openapi.json not served: %d", rec.Code)
+	}
+}
+
+func TestOpenAPI_Dscan(t *testing.T) {
+	fakeStaticData(t)
+	doc := loadOpenAPI(t)
+
+	form := url.Values{"scan": {"587\tRifter\tRifter\t2,000 km\n99999\tMystery\tSomething\t-\nnot a scan line"}}
+	req := httptest.NewRequest(http.MethodPost, "/dscan", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	newRouter().ServeHTTP(rec, req)
+
+	schema, err := doc.responseSchema("/dscan", "post", rec.Code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v any
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.validate(schema, v, "body"); err != nil {
+		t.Fatalf("%v\n%s", err, rec.Body.String())
+	}
+}
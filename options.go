@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+)
+
+// zKillboard refuses pastSeconds beyond a week
+const maxKillWindowDays = 7
+
+// lookupOptions are what a client may ask for on a single lookup. Zero values
+// and nil pointers fall back to the server defaults.
+type lookupOptions struct {
+	// Limit caps the number of names and ids looked up
+	Limit int `json:"limit,omitempty"`
+	// AnalyzeKills turns the killmail analysis on or off
+	AnalyzeKills *bool `json:"analyze_kills,omitempty"`
+	// FavoriteShip picks the most used ship from the analyzed kills
+	FavoriteShip *bool `json:"favorite_ship,omitempty"`
+	// KillWindowDays is how far back "kills last week" counts, in days
+	KillWindowDays int `json:"kill_window_days,omitempty"`
+	// Ordered streams results in paste order instead of as they finish
+	Ordered bool `json:"ordered,omitempty"`
+	// Save keeps the completed lookup as a snapshot that can be shared
+	Save bool `json:"save,omitempty"`
+}
+
+// lookupSettings is what a lookup actually runs with once the operator
+// limits have been applied to the requested options
+type lookupSettings struct {
+	maxNames     int
+	analyzeKills bool
+	favoriteShip bool
+	killWindow   int // seconds
+	ordered      bool
+	save         bool
+}
+
+type settingsKey struct{}
+
+// defaultSettings come from the command line flags
+func defaultSettings() lookupSettings {
+	return lookupSettings{
+		maxNames:     maximumNames,
+		analyzeKills: analyzeKills,
+		favoriteShip: computeFavoriteShip,
+		killWindow:   min(defaultKillWindowDays, maxKillWindowDays) * secondsInDay,
+	}
+}
+
+// settings applies the options on top of the defaults, an option can never
+// exceed what the operator allows
+func (o lookupOptions) settings() lookupSettings {
+	s := defaultSettings()
+
+	if o.Limit > 0 {
+		s.maxNames = min(o.Limit, maximumNames)
+	}
+	// turning kill analysis off is always fine, turning it on needs
+	// -allow-kills unless the operator already has it on
+	if o.AnalyzeKills != nil {
+		s.analyzeKills = *o.AnalyzeKills && (s.analyzeKills || allowKills)
+	}
+	if o.FavoriteShip != nil {
+		s.favoriteShip = *o.FavoriteShip
+	}
+	if o.KillWindowDays > 0 {
+		s.killWindow = min(o.KillWindowDays, maxKillWindowDays) * secondsInDay
+	}
+	s.ordered = o.Ordered
+	s.save = o.Save
+
+	return s
+}
+
+func withSettings(ctx context.Context, s lookupSettings) context.Context {
+	return context.WithValue(ctx, settingsKey{}, s)
+}
+
+// settingsFrom returns the settings of the lookup ctx belongs to, or the
+// server defaults outside of a lookup
+func settingsFrom(ctx context.Context) lookupSettings {
+	if s, ok := ctx.Value(settingsKey{}).(lookupSettings); ok {
+		return s
+	}
+	return defaultSettings()
+}
+
+// optionsFromForm reads lookup options from form or query values:
+// limit, kills, favorite_ship, kill_window, ordered and save
+func optionsFromForm(r *http.Request) lookupOptions {
+	var o lookupOptions
+
+	o.Limit, _ = strconv.Atoi(r.FormValue("limit"))
+	o.KillWindowDays, _ = strconv.Atoi(r.FormValue("kill_window"))
+	o.AnalyzeKills = formBool(r, "kills")
+	o.FavoriteShip = formBool(r, "favorite_ship")
+	if ordered := formBool(r, "ordered"); ordered != nil {
+		o.Ordered = *ordered
+	}
+	if save := formBool(r, "save"); save != nil {
+		o.Save = *save
+	}
+
+	return o
+}
+
+func formBool(r *http.Request, key string) *bool {
+	b, err := strconv.ParseBool(r.FormValue(key))
+	if err != nil {
+		return nil
+	}
+	return &b
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLookupOptions_Settings(t *testing.T) {
+	oldKills, oldAllow, oldMax := analyzeKills, allowKills, maximumNames
+	defer func() { analyzeKills, allowKills, maximumNames = oldKills, oldAllow, oldMax }()
+
+	analyzeKills, allowKills, maximumNames = false, true, 100
+	yes, no := true, false
+
+	cases := []struct {
+		name  string
+		allow bool
+		opts  lookupOptions
+		want  lookupSettings
+	}{
+		{"defaults", true, lookupOptions{}, lookupSettings{maxNames: 100, killWindow: secondsInDay * 7}},
+		{"lower limit", true, lookupOptions{Limit: 10}, lookupSettings{maxNames: 10, killWindow: secondsInDay * 7}},
+		{"limit can't exceed the server", true, lookupOptions{Limit: 1000}, lookupSettings{maxNames: 100, killWindow: secondsInDay * 7}},
+		{"kills on", true, lookupOptions{AnalyzeKills: &yes, FavoriteShip: &yes}, lookupSettings{maxNames: 100, analyzeKills: true, favoriteShip: true, killWindow: secondsInDay * 7}},
+		{"kills not allowed", false, lookupOptions{AnalyzeKills: &yes}, lookupSettings{maxNames: 100, killWindow: secondsInDay * 7}},
+		{"kills off", true, lookupOptions{AnalyzeKills: &no}, lookupSettings{maxNames: 100, killWindow: secondsInDay * 7}},
+		{"short window", true, lookupOptions{KillWindowDays: 2}, lookupSettings{maxNames: 100, killWindow: secondsInDay * 2}},
+		{"window capped", true, lookupOptions{KillWindowDays: 30}, lookupSettings{maxNames: 100, killWindow: secondsInDay * 7}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			allowKills = tc.allow
+			if got := tc.opts.settings(); got != tc.want {
+				t.Fatalf("settings() = %+v; want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLookupOptions_OperatorKills(t *testing.T) {
+	oldKills, oldAllow := analyzeKills, allowKills
+	defer func() { analyzeKills, allowKills = oldKills, oldAllow }()
+
+	// -kills -allow-kills=false keeps analysis on, requests can only turn it off
+	analyzeKills, allowKills = true, false
+	yes, no := true, false
+
+	if !defaultSettings().analyzeKills {
+		t.Fatal("expected -kills to stand without -allow-kills")
+	}
+	if !(lookupOptions{AnalyzeKills: &yes}).settings().analyzeKills {
+		t.Fatal("expected a request asking for kills to keep the default")
+	}
+	if (lookupOptions{AnalyzeKills: &no}).settings().analyzeKills {
+		t.Fatal("expected a request to turn kill analysis off")
+	}
+}
+
+func TestDefaultAllowKills(t *testing.T) {
+	oldKills, oldAllow := analyzeKills, allowKills
+	defer func() { analyzeKills, allowKills = oldKills, oldAllow }()
+
+	if f := flag.Lookup("allow-kills"); f == nil || f.DefValue != "false" {
+		t.Fatalf("expected -allow-kills to default to false, got %+v", f)
+	}
+
+	// without -allow-kills requests may turn on what the operator turned on
+	for _, kills := range []bool{false, true} {
+		analyzeKills, allowKills = kills, !kills
+		defaultAllowKills()
+		if allowKills != kills {
+			t.Errorf("with -kills=%v allowKills = %v", kills, allowKills)
+		}
+	}
+}
+
+func TestOptionsFromForm(t *testing.T) {
+	r := httptest.NewRequest("GET", "/info/events?limit=5&kills=true&favorite_ship=0&kill_window=3", nil)
+	o := optionsFromForm(r)
+
+	if o.Limit != 5 || o.KillWindowDays != 3 {
+		t.Fatalf("unexpected options %+v", o)
+	}
+	if o.AnalyzeKills == nil || !*o.AnalyzeKills || o.FavoriteShip == nil || *o.FavoriteShip {
+		t.Fatalf("unexpected boolean options %+v", o)
+	}
+
+	o = optionsFromForm(httptest.NewRequest("GET", "/info/events", nil))
+	if o.AnalyzeKills != nil || o.FavoriteShip != nil || o.Limit != 0 {
+		t.Fatalf("expected empty options, got %+v", o)
+	}
+}
+
+func TestSettingsFrom_Context(t *testing.T) {
+	s := lookupSettings{maxNames: 3, killWindow: secondsInDay}
+	if got := settingsFrom(withSettings(context.Background(), s)); got != s {
+		t.Fatalf("expected settings to round trip, got %+v", got)
+	}
+	if got := settingsFrom(context.Background()); got != defaultSettings() {
+		t.Fatalf("expected defaults outside a lookup, got %+v", got)
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// the formats parsePaste recognises, reported in the start record
+type pasteFormat string
+
+const (
+	// member lists and Local, one name per line
+	formatNames pasteFormat = "names"
+	// chat transcripts, "[ 2026.10.16 12:00:00 ] Name > message"
+	formatChat pasteFormat = "chat"
+	// tab separated copies of a window, the name is the first column
+	formatTabbed pasteFormat = "tabbed"
+	// the fleet window, name, system, ship type, role and position
+	formatFleet pasteFormat = "fleet"
+	// zKillboard and ESI links to kills and characters
+	formatLinks pasteFormat = "links"
+)
+
+// EVE names are at least 3 characters long, character names at most 37 and
+// corporation and alliance names at most 50
+const (
+	minNameLength          = 3
+	maxCharacterNameLength = 37
+	maxNameLength          = 50
+)
+
+// validateName checks a name against the EVE naming rules: letters, digits,
+// spaces, hyphens and apostrophes, no space, hyphen or apostrophe at either
+// end and no double spaces. Periods are let through for corporation and
+// alliance names. It returns why the name was rejected, empty when it's fine.
+func validateName(name string) string {
+	switch {
+	case len(name) < minNameLength:
+		return "too short for a name"
+	case len(name) > maxNameLength:
+		return "too long for a name"
+	}
+
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == ' ', r == '-', r == '\'', r == '.':
+		default:
+			return fmt.Sprintf("%q is not allowed in a name", r)
+		}
+	}
+
+	// only ASCII is left, so the ends are single bytes
+	for _, end := range []byte{name[0], name[len(name)-1]} {
+		if end == ' ' || end == '-' || end == '\'' {
+			return fmt.Sprintf("a name can't start or end with %q", end)
+		}
+	}
+	if strings.Contains(name, "  ") {
+		return "a name can't have two spaces in a row"
+	}
+
+	return ""
+}
+
+var chatLineRegex = regexp.MustCompile(`^\[\s*\d{4}\.\d{2}\.\d{2} \d{2}:\d{2}:\d{2}\s*\]\s*(.+?)\s+>`)
+
+// the role column is what tells a fleet window copy from other tab separated text
+var fleetRoleRegex = regexp.MustCompile(`(?i)^(fleet commander|wing commander|squad commander|squad member)\b`)
+
+// speaker of client notices in chat transcripts
+const chatSystemSpeaker = "EVE System"
+
+// unparsedLine is a line of the paste no name could be taken from
+type unparsedLine struct {
+	Index  int    `json:"index"`
+	Input  string `json:"input"`
+	Reason string `json:"reason"`
+}
+
+// paste is pasted text split into lookup jobs, truncated are the jobs past
+// the limit
+type paste struct {
+	format    pasteFormat
+	jobs      []lookupJob
+	unparsed  []unparsedLine
+	truncated []lookupJob
+}
+
+// names are the names of the jobs, links are left out
+func (p paste) names() []string {
+	names := make([]string, 0, len(p.jobs))
+	for _, j := range p.jobs {
+		if j.name != "" {
+			names = append(names, j.name)
+		}
+	}
+	return names
+}
+
+// pasteLine is one non-blank line with the format it looks like and the name
+// found in it, reason says why there is no name
+type pasteLine struct {
+	index  int
+	input  string
+	format pasteFormat
+	name   string
+	reason string
+	fleet  *fleetMember
+	// character, corporation, alliance and kill links, entity is set with id
+	// for corporations and alliances
+	id       int
+	entity   string
+	killmail *killLink
+}
+
+func (l pasteLine) empty() bool {
+	return l.name == "" && l.id == 0 && l.killmail == nil
+}
+
+// key is what duplicates are detected by, names differing only in case are
+// the same character
+func (l pasteLine) key() string {
+	switch {
+	case l.killmail != nil:
+		return fmt.Sprint("kill:", l.killmail.id)
+	case l.id != 0:
+		return fmt.Sprint(l.entity, "id:", l.id)
+	}
+	return nameKey(l.name)
+}
+
+// parseFleetLine reads a row of the fleet window: name, system, ship type,
+// then the role and, after it, the position in the wings and squads
+func parseFleetLine(line string) (string, *fleetMember, bool) {
+	fields := strings.Split(line, "\t")
+	if len(fields) < 4 {
+		return "", nil, false
+	}
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+
+	role := slices.IndexFunc(fields[3:], fleetRoleRegex.MatchString)
+	if role < 0 {
+		return "", nil, false
+	}
+	role += 3
+
+	m := &fleetMember{System: fields[1], Ship: fields[2], Role: fields[role]}
+	if role+1 < len(fields) {
+		m.Position = fields[role+1]
+	}
+	return fields[0], m, true
+}
+
+func classifyLine(index int, line string) pasteLine {
+	if pl, ok := parseLink(index, line); ok {
+		return pl
+	}
+
+	pl := pasteLine{index: index, input: line}
+
+	trimmed := strings.TrimSpace(line)
+	switch {
+	case chatLineRegex.MatchString(trimmed):
+		pl.format = formatChat
+		pl.name = strings.TrimSpace(chatLineRegex.FindStringSubmatch(trimmed)[1])
+		if pl.name == chatSystemSpeaker {
+			pl.name, pl.reason = "", "system message"
+		}
+	case strings.Contains(line, "\t"):
+		if name, m, ok := parseFleetLine(line); ok {
+			pl.format, pl.name, pl.fleet = formatFleet, name, m
+			break
+		}
+		pl.format = formatTabbed
+		pl.name, _, _ = strings.Cut(line, "\t")
+		pl.name = strings.TrimSpace(pl.name)
+	default:
+		pl.format = formatNames
+		pl.name = trimmed
+	}
+
+	if pl.name == "" {
+		if pl.reason == "" {
+			pl.reason = "no name found"
+		}
+		return pl
+	}
+
+	if reason := validateName(pl.name); reason != "" {
+		pl.name, pl.reason = "", reason
+	}
+
+	return pl
+}
+
+// detectFormat picks the format most lines look like, chat wins ties as its
+// lines can't be mistaken for anything else
+func detectFormat(lines []pasteLine) pasteFormat {
+	counts := make(map[pasteFormat]int)
+	for _, l := range lines {
+		counts[l.format]++
+	}
+
+	best, most := formatNames, 0
+	for _, f := range []pasteFormat{formatChat, formatFleet, formatLinks, formatTabbed, formatNames} {
+		if counts[f] > most {
+			best, most = f, counts[f]
+		}
+	}
+	return best
+}
+
+// parsePaste works out which client window text was copied from and takes
+// the character names out of it, de-duplicated and stopping at limit names.
+// Blank lines are ignored, every other line without a name is reported, as
+// are the names past the limit.
+func parsePaste(text string, limit int) paste {
+	raw := newlineRegex.Split(text, -1)
+
+	lines := make([]pasteLine, 0, len(raw))
+	for i, line := range raw {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		lines = append(lines, classifyLine(i, line))
+	}
+
+	p := paste{
+		format:   detectFormat(lines),
+		jobs:     make([]lookupJob, 0, len(lines)),
+		unparsed: make([]unparsedLine, 0),
+	}
+
+	seen := make(map[string]struct{})
+	for _, l := range lines {
+		// the header of a chat log and wrapped messages are not names
+		if p.format == formatChat && l.format != formatChat {
+			l.name, l.reason = "", "not a chat line"
+		}
+		if l.empty() {
+			p.unparsed = append(p.unparsed, unparsedLine{Index: l.index, Input: l.input, Reason: l.reason})
+			continue
+		}
+		if _, ok := seen[l.key()]; ok {
+			continue
+		}
+		seen[l.key()] = struct{}{}
+		job := lookupJob{
+			index:    l.index,
+			input:    l.input,
+			name:     l.name,
+			id:       l.id,
+			entity:   l.entity,
+			fleet:    l.fleet,
+			killmail: l.killmail,
+		}
+		if len(p.jobs) >= limit {
+			p.truncated = append(p.truncated, job)
+			continue
+		}
+		p.jobs = append(p.jobs, job)
+	}
+
+	return p
+}
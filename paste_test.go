@@ -0,0 +1,164 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParsePaste(t *testing.T) {
+	tests := []struct {
+		name       string
+		text       string
+		wantFormat pasteFormat
+		wantNames  []string
+		wantSkip   []int // line indexes reported as unparsed
+	}{
+		{
+			name:       "member list",
+			text:       "Mynxee\n\nPortia Tigana\nab\nMynxee\n",
+			wantFormat: formatNames,
+			wantNames:  []string{"Mynxee", "Portia Tigana"},
+			wantSkip:   []int{3},
+		},
+		{
+			name: "chat transcript",
+			text: "---------------------------------------------------------------\n" +
+				"  Channel ID:      local\n" +
+				"  Listener:        Mynxee\n" +
+				"---------------------------------------------------------------\n" +
+				"[ 2026.10.16 12:00:00 ] EVE System > Channel changed to Local : Jita\n" +
+				"[ 2026.10.16 12:00:01 ] Mynxee > o7\n" +
+				"[ 2026.10.16 12:00:02 ] Portia Tigana > anyone > around?\n" +
+				"[2026.10.16 12:00:03] Mynxee > again\n",
+			wantFormat: formatChat,
+			wantNames:  []string{"Mynxee", "Portia Tigana"},
+			wantSkip:   []int{0, 1, 2, 3, 4},
+		},
+		{
+			name:       "tab separated",
+			text:       "Mynxee\tJita\tRifter\n Portia Tigana \tAmarr\tHeron\n\tnothing\n",
+			wantFormat: formatTabbed,
+			wantNames:  []string{"Mynxee", "Portia Tigana"},
+			wantSkip:   []int{2},
+		},
+		{
+			name: "fleet window",
+			text: "Mynxee\tJita\tRifter\tFrigate\tFleet Commander\tFleet\n" +
+				"Portia Tigana\tJita\tHeron\tFrigate\tSquad Member\tWing 1 / Squad 1\n" +
+				"Some\tother\trow\n",
+			wantFormat: formatFleet,
+			wantNames:  []string{"Mynxee", "Portia Tigana", "Some"},
+		},
+		{
+			name:       "names win over a stray chat line",
+			text:       "Mynxee\nPortia Tigana\n[ 2026.10.16 12:00:01 ] Sif Noban > hi\n",
+			wantFormat: formatNames,
+			wantNames:  []string{"Mynxee", "Portia Tigana", "Sif Noban"},
+		},
+		{
+			name:       "names differing in case are one character",
+			text:       "Mynxee\nmynxee\nMYNXEE\n",
+			wantFormat: formatNames,
+			wantNames:  []string{"Mynxee"},
+		},
+		{
+			name:       "too long",
+			text:       "This line is far too long to be anybody's name, or any corp's\n",
+			wantFormat: formatNames,
+			wantSkip:   []int{0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := parsePaste(tt.text, 10)
+
+			if p.format != tt.wantFormat {
+				t.Errorf("format = %q, want %q", p.format, tt.wantFormat)
+			}
+
+			var names []string
+			for _, j := range p.jobs {
+				names = append(names, j.name)
+			}
+			if len(names) != len(tt.wantNames) {
+				t.Fatalf("names = %q, want %q", names, tt.wantNames)
+			}
+			for i := range names {
+				if names[i] != tt.wantNames[i] {
+					t.Fatalf("names = %q, want %q", names, tt.wantNames)
+				}
+			}
+
+			if len(p.unparsed) != len(tt.wantSkip) {
+				t.Fatalf("unparsed = %+v, want lines %v", p.unparsed, tt.wantSkip)
+			}
+			for i, u := range p.unparsed {
+				if u.Index != tt.wantSkip[i] || u.Reason == "" {
+					t.Fatalf("unparsed = %+v, want lines %v", p.unparsed, tt.wantSkip)
+				}
+			}
+		})
+	}
+}
+
+func TestParsePaste_KeepsLineAndInput(t *testing.T) {
+	p := parsePaste("\n[ 2026.10.16 12:00:01 ] Mynxee > o7", 10)
+
+	want := lookupJob{index: 1, input: "[ 2026.10.16 12:00:01 ] Mynxee > o7", name: "Mynxee"}
+	if len(p.jobs) != 1 || p.jobs[0] != want {
+		t.Fatalf("jobs = %+v, want %+v", p.jobs, want)
+	}
+}
+
+func TestParsePaste_Truncated(t *testing.T) {
+	p := parsePaste("Mynxee\nPortia Tigana\nab\nSif Noban\nMynxee\nAda Lin\n", 2)
+
+	if len(p.jobs) != 2 || len(p.truncated) != 2 {
+		t.Fatalf("expected 2 jobs and 2 truncated, got %+v", p)
+	}
+	if p.truncated[0].name != "Sif Noban" || p.truncated[0].index != 3 || p.truncated[1].name != "Ada Lin" {
+		t.Fatalf("unexpected truncated jobs %+v", p.truncated)
+	}
+	if len(p.unparsed) != 1 || p.unparsed[0].Index != 2 {
+		t.Fatalf("expected lines past the limit to still be checked, got %+v", p.unparsed)
+	}
+}
+
+func TestParsePaste_Fleet(t *testing.T) {
+	p := parsePaste("Portia Tigana\tAmarr\tHeron\tFrigate\tSquad Member\tWing 1 / Squad 2\tskills", 10)
+
+	if len(p.jobs) != 1 || p.jobs[0].fleet == nil {
+		t.Fatalf("expected one fleet member, got %+v", p.jobs)
+	}
+	want := fleetMember{System: "Amarr", Ship: "Heron", Role: "Squad Member", Position: "Wing 1 / Squad 2"}
+	if got := *p.jobs[0].fleet; got != want {
+		t.Fatalf("fleet = %+v, want %+v", got, want)
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"Mynxee", true},
+		{"Portia Tigana", true},
+		{"Sven O'Malley", true},
+		{"Ada-Lin 2", true},
+		{"Pandemic Horde Inc.", true},
+		{"ab", false},
+		{"Signal Cartel Exploration Division Of New Eden", true},
+		{"This name is far too long for any pilot, corporation or alliance", false},
+		{"Bad_Name", false},
+		{"Åsa Nord", false},
+		{"Two  Spaces", false},
+		{"-Mynxee", false},
+		{"Mynxee'", false},
+	}
+
+	for _, tt := range tests {
+		if reason := validateName(tt.name); (reason == "") != tt.valid {
+			t.Errorf("validateName(%q) = %q, want valid %v", tt.name, reason, tt.valid)
+		}
+	}
+}
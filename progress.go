@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// the stages a character goes through in fetchCharacterData
+type lookupPhase string
+
+const (
+	phaseIDs   lookupPhase = "ids"
+	phaseCCP   lookupPhase = "ccp"
+	phaseZkill lookupPhase = "zkill"
+	phaseKills lookupPhase = "kills"
+)
+
+var lookupPhases = []lookupPhase{phaseIDs, phaseCCP, phaseZkill, phaseKills}
+
+type phaseCount struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+// lookupProgress counts how far a lookup has got through each phase. It is
+// carried in the request context so the fetch functions can report to it
+// without knowing who is listening, all methods are safe on a nil receiver.
+type lookupProgress struct {
+	start time.Time
+
+	mu     sync.Mutex
+	phases map[lookupPhase]*phaseCount
+	dirty  bool
+}
+
+type progressKey struct{}
+
+func newLookupProgress(total int) *lookupProgress {
+	p := &lookupProgress{
+		start:  time.Now(),
+		phases: make(map[lookupPhase]*phaseCount, len(lookupPhases)),
+	}
+	for _, ph := range lookupPhases {
+		p.phases[ph] = &phaseCount{}
+	}
+	p.phases[phaseIDs].Total = total
+	return p
+}
+
+func withProgress(ctx context.Context, p *lookupProgress) context.Context {
+	return context.WithValue(ctx, progressKey{}, p)
+}
+
+func progressFrom(ctx context.Context) *lookupProgress {
+	p, _ := ctx.Value(progressKey{}).(*lookupProgress)
+	return p
+}
+
+// expect adds a unit of work to a phase
+func (p *lookupProgress) expect(ph lookupPhase) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.phases[ph].Total++
+	p.dirty = true
+	p.mu.Unlock()
+}
+
+// finish marks a unit of work in a phase as complete
+func (p *lookupProgress) finish(ph lookupPhase) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.phases[ph].Done++
+	p.dirty = true
+	p.mu.Unlock()
+}
+
+// track wraps a fetcher so the phase is finished when it returns
+func (p *lookupProgress) track(ph lookupPhase, f func(context.Context, int) *characterResponse) func(context.Context, int) *characterResponse {
+	if p == nil {
+		return f
+	}
+	return func(ctx context.Context, id int) *characterResponse {
+		defer p.finish(ph)
+		return f(ctx, id)
+	}
+}
+
+// changed reports whether anything happened since the last call
+func (p *lookupProgress) changed() bool {
+	if p == nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	d := p.dirty
+	p.dirty = false
+	return d
+}
+
+// record builds the progress meta record, phase is the first phase that
+// still has outstanding work
+func (p *lookupProgress) record(sent, failed int) map[string]any {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	phases := make(map[lookupPhase]phaseCount, len(p.phases))
+	current := lookupPhase("")
+	for _, ph := range lookupPhases {
+		c := *p.phases[ph]
+		phases[ph] = c
+		if current == "" && c.Done < c.Total {
+			current = ph
+		}
+	}
+
+	return map[string]any{
+		"_meta":   eventProgress,
+		"phase":   current,
+		"phases":  phases,
+		"sent":    sent,
+		"failed":  failed,
+		"total":   p.phases[phaseIDs].Total,
+		"elapsed": time.Since(p.start).Seconds(),
+	}
+}
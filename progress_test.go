@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestLookupProgress_Phases(t *testing.T) {
+	p := newLookupProgress(2)
+	ctx := withProgress(context.Background(), p)
+
+	if progressFrom(ctx) != p {
+		t.Fatalf("expected progress to round trip through the context")
+	}
+
+	ccp := p.track(phaseCCP, func(context.Context, int) *characterResponse {
+		return &characterResponse{&characterData{}, nil}
+	})
+
+	p.finish(phaseIDs)
+	p.expect(phaseCCP)
+
+	rec := p.record(0, 0)
+	if rec["phase"] != phaseIDs {
+		t.Fatalf("expected ids to be the current phase, got %v", rec["phase"])
+	}
+
+	p.finish(phaseIDs)
+	ccp(ctx, 1)
+
+	if !p.changed() {
+		t.Fatalf("expected a change to be reported")
+	}
+	if p.changed() {
+		t.Fatalf("expected changed to reset")
+	}
+
+	rec = p.record(2, 0)
+	phases := rec["phases"].(map[lookupPhase]phaseCount)
+	if phases[phaseIDs] != (phaseCount{Done: 2, Total: 2}) || phases[phaseCCP] != (phaseCount{Done: 1, Total: 1}) {
+		t.Fatalf("unexpected phase counts %v", phases)
+	}
+	if rec["phase"] != lookupPhase("") || rec["sent"] != 2 || rec["total"] != 2 {
+		t.Fatalf("unexpected record %v", rec)
+	}
+}
+
+func TestLookupProgress_NilSafe(t *testing.T) {
+	p := progressFrom(context.Background())
+	if p != nil {
+		t.Fatalf("expected no progress in a bare context")
+	}
+
+	// none of these should panic
+	p.expect(phaseCCP)
+	p.finish(phaseCCP)
+	if p.changed() {
+		t.Fatalf("nil progress never changes")
+	}
+	if p.track(phaseCCP, fetchCCPRecord) == nil {
+		t.Fatalf("track should return the fetcher unchanged")
+	}
+}
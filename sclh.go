@@ -2,8 +2,6 @@ package main
 
 import (
 	"context"
-	"regexp"
-
 	"crypto/tls"
 	"flag"
 	"fmt"
@@ -15,8 +13,6 @@ import (
 	"os/signal"
 	"path/filepath"
 	"strconv"
-	"strings"
-	"sync"
 	"syscall"
 	"time"
 
@@ -30,9 +26,11 @@ import (
 )
 
 const (
-	maximumNames = 100
-	userAgent    = "https://sclh.ddns.net Maintainer: kat1248@gmail.com"
-	maxWorkers   = 10
+	userAgent        = "https://sclh.ddns.net Maintainer: kat1248@gmail.com"
+	progressInterval = 250 * time.Millisecond
+	// highest -max-names accepted, every name costs several ESI and
+	// zKillboard calls
+	maxNamesCeiling = 5000
 )
 
 var (
@@ -41,16 +39,58 @@ var (
 	localMode    bool
 	analyzeKills bool
 
-	httpClient *http.Client
-)
+	// operator limits, requests can lower these but never raise them
+	maximumNames          = 100
+	maxWorkers            = 10
+	allowKills            = false
+	defaultKillWindowDays = maxKillWindowDays
 
-var newlineRegex = regexp.MustCompile(`\r?\n|\r`)
+	httpClient = http.DefaultClient
+)
 
 func init() {
 	flag.IntVar(&port, "port", 80, "port to listen on")
 	flag.BoolVar(&debugMode, "debug", false, "debug mode switch")
 	flag.BoolVar(&localMode, "local", false, "run server locally without TLS")
-	flag.BoolVar(&analyzeKills, "kills", false, "do more analysis on kills")
+	flag.BoolVar(&analyzeKills, "kills", false, "do more analysis on kills by default")
+	flag.BoolVar(&allowKills, "allow-kills", false, "allow requests to turn on kill analysis (default the value of -kills)")
+	flag.BoolVar(&computeFavoriteShip, "favorite-ship", false, "compute the favorite ship by default")
+	flag.IntVar(&maximumNames, "max-names", maximumNames, "maximum names in a single lookup")
+	flag.IntVar(&maxWorkers, "workers", maxWorkers, "concurrent character fetches per lookup")
+	flag.IntVar(&maxSSESessions, "event-streams", maxSSESessions, "lookups run by /info/events at once")
+	flag.IntVar(&defaultKillWindowDays, "kill-window", defaultKillWindowDays, "days counted for recent kills by default")
+	flag.Func("threat-weights", "threat score weights to change, e.g. danger=40,gang=0", setThreatWeights)
+	flag.StringVar(&snapshotDir, "snapshot-dir", "./snapshots", "directory saved lookups are kept in")
+	flag.DurationVar(&snapshotTTL, "snapshot-ttl", 7*24*time.Hour, "how long saved lookups are kept, 0 keeps them forever")
+}
+
+// defaultAllowKills lets requests turn on kill analysis when the operator
+// turned it on by default, unless -allow-kills says otherwise
+func defaultAllowKills() {
+	explicit := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "allow-kills" {
+			explicit = true
+		}
+	})
+	if !explicit {
+		allowKills = analyzeKills
+	}
+}
+
+func checkLimits() {
+	if maximumNames < 1 || maximumNames > maxNamesCeiling {
+		log.Fatalf("Invalid -max-names value: %d, must be 1 to %d", maximumNames, maxNamesCeiling)
+	}
+	if maxWorkers < 1 {
+		log.Fatalf("Invalid -workers value: %d", maxWorkers)
+	}
+	if maxSSESessions < 1 {
+		log.Fatalf("Invalid -event-streams value: %d", maxSSESessions)
+	}
+	if defaultKillWindowDays < 1 || defaultKillWindowDays > maxKillWindowDays {
+		log.Fatalf("Invalid -kill-window value: %d, must be 1 to %d", defaultKillWindowDays, maxKillWindowDays)
+	}
 }
 
 func setupHTTPClient() {
@@ -128,12 +168,37 @@ func securityHeaders(next http.Handler) http.Handler {
 	})
 }
 
+func newRouter() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
+	mux.Handle("/images/", http.StripPrefix("/images/", http.FileServer(http.Dir("images"))))
+	mux.HandleFunc("/info", serveData)
+	mux.HandleFunc("GET /info/events", serveEvents)
+	mux.Handle("GET /info/live", serveLive)
+	mux.HandleFunc("GET /api/v1/characters/{character}", apiCharacterHandler)
+	mux.HandleFunc("POST /api/v1/lookups", apiLookupsHandler)
+	mux.HandleFunc("GET /api/v1/snapshots/{id}", apiSnapshotHandler)
+	mux.HandleFunc("GET /api/v1/suggest", apiSuggestHandler)
+	mux.HandleFunc("GET /r/{id}", snapshotPageHandler)
+	mux.HandleFunc("/r/{id}/export", snapshotExportHandler)
+	mux.HandleFunc("POST /export", exportHandler)
+	mux.HandleFunc("POST /dscan", dscanHandler)
+	mux.HandleFunc("/", defaultHandler)
+	mux.HandleFunc("/health", healthCheckHandler)
+	mux.HandleFunc("GET /openapi.json", openAPIHandler)
+	mux.HandleFunc("/favicon.ico", faviconHandler)
+	return mux
+}
+
 func main() {
 	flag.Parse()
 	port = parsePort()
+	defaultAllowKills()
+	checkLimits()
 
 	setupLogging()
 	setupHTTPClient()
+	setupSnapshots()
 
 	// pprof server
 	go func() {
@@ -144,13 +209,7 @@ func main() {
 
 	checkESIConnectivity()
 
-	mux := http.NewServeMux()
-	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
-	mux.Handle("/images/", http.StripPrefix("/images/", http.FileServer(http.Dir("images"))))
-	mux.HandleFunc("/info", serveData)
-	mux.HandleFunc("/", defaultHandler)
-	mux.HandleFunc("/health", healthCheckHandler)
-	mux.HandleFunc("/favicon.ico", faviconHandler)
+	mux := newRouter()
 
 	handler := securityHeaders(mux)
 
@@ -226,40 +285,28 @@ func faviconHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
 	io.WriteString(w, `{"alive": true}`)
 }
 
+// the OpenAPI document describing every endpoint, keep it in step with data.go
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	http.ServeFile(w, r, "static/openapi.json")
+}
+
 func serveData(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
-	ctx := r.Context()
+	settings := optionsFromForm(r).settings()
+	ctx := withSettings(r.Context(), settings)
 
-	raw := newlineRegex.Split(r.FormValue("characters"), -1)
+	p := parsePaste(r.FormValue("characters"), settings.maxNames)
 
-	seen := make(map[string]struct{})
-	names := make([]string, 0, len(raw))
-
-	for _, n := range raw {
-		n = strings.TrimSpace(n)
-		if len(n) < 3 {
-			continue
-		}
-		if _, ok := seen[n]; ok {
-			continue
-		}
-		seen[n] = struct{}{}
-		names = append(names, n)
-		if len(names) >= maximumNames {
-			break
-		}
-	}
-
-	log.WithField("count", len(names)).Info("request received")
+	log.WithFields(log.Fields{"count": len(p.jobs), "format": p.format}).Info("request received")
 
 	defer func() {
 		log.WithFields(log.Fields{
-			"count":   len(names),
+			"count":   len(p.jobs),
 			"elapsed": time.Since(start).Seconds(),
 		}).Info("request completed")
 	}()
@@ -277,88 +324,28 @@ func serveData(w http.ResponseWriter, r *http.Request) {
 
 	enc := json.NewEncoder(w)
 
-	// announce start
-	if err := enc.Encode(map[string]any{
-		"_meta": "start",
-		"total": len(names),
-	}); err != nil {
-		log.WithError(err).Warn("failed to write start response")
-		return
-	}
-	flusher.Flush()
-
-	if ok, err := loadCharacterIds(ctx, names); !ok {
-		log.WithError(err).Warn("failed to preload character IDs")
-	}
-
-	jobs := make(chan string)
-	results := make(chan *characterResponse, maxWorkers)
-
-	var wg sync.WaitGroup
-
-	// workers
-	for i := 0; i < maxWorkers; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for name := range jobs {
-				select {
-				case results <- fetchCharacterData(ctx, name):
-				case <-ctx.Done():
-					return
-				}
-			}
-		}()
-	}
-
-	// feed jobs
-	go func() {
-		for _, name := range names {
-			select {
-			case jobs <- name:
-			case <-ctx.Done():
-				break
-			}
-		}
-		close(jobs)
-	}()
-
-	// close results
-	go func() {
-		wg.Wait()
-		close(results)
-	}()
-
-	sent := 0
-
-	for resp := range results {
-		if resp.err != nil {
-			log.WithError(resp.err).Error("fetch failed")
-			continue
-		}
-
-		if err := enc.Encode(resp.char); err != nil {
-			log.Warn("client disconnected")
-			return
+	// NDJSON records carry their own _meta type so the event name isn't needed
+	emit := func(_ string, rec any) error {
+		if err := enc.Encode(rec); err != nil {
+			return err
 		}
 		flusher.Flush()
-
-		sent++
+		return nil
 	}
 
-	if err := enc.Encode(map[string]any{
-		"_meta": "done",
-		"sent":  sent,
-		"total": len(names),
-	}); err != nil {
-		log.WithError(err).Warn("failed to write final response")
-		return
+	if err := streamLookup(ctx, p, emit); err != nil {
+		log.WithError(err).Warn("client disconnected")
 	}
-	flusher.Flush()
+}
+
+// what the index template is rendered with, Snapshot is set when showing a
+// saved lookup
+type pageData struct {
+	Snapshot      *snapshot
+	ExportColumns []string
 }
 
 func defaultHandler(w http.ResponseWriter, r *http.Request) {
-	lp := filepath.Join("templates", "layout.html")
 	fp := filepath.Join("templates", "index.html")
 
 	// Return a 404 if the template doesn't exist
@@ -376,6 +363,13 @@ func defaultHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	renderIndex(w, pageData{})
+}
+
+func renderIndex(w http.ResponseWriter, data pageData) {
+	lp := filepath.Join("templates", "layout.html")
+	fp := filepath.Join("templates", "index.html")
+
 	tmpl, err := template.ParseFiles(lp, fp)
 	if err != nil {
 		// Log the detailed error
@@ -385,7 +379,9 @@ func defaultHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := tmpl.ExecuteTemplate(w, "layout", nil); err != nil {
+	data.ExportColumns = exportColumnNames()
+
+	if err := tmpl.ExecuteTemplate(w, "layout", data); err != nil {
 		log.Error(err.Error())
 		http.Error(w, http.StatusText(500), 500)
 	}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// postInfo sends names to serveData and returns the decoded NDJSON records
+func postInfo(t *testing.T, names string) []map[string]any {
+	t.Helper()
+
+	form := url.Values{"characters": {names}}
+	req := httptest.NewRequest(http.MethodPost, "/info", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+
+	serveData(rec, req)
+
+	var records []map[string]any
+	sc := bufio.NewScanner(rec.Body)
+	for sc.Scan() {
+		var m map[string]any
+		if err := json.Unmarshal(sc.Bytes(), &m); err != nil {
+			t.Fatalf("bad record %q: %v", sc.Text(), err)
+		}
+		records = append(records, m)
+	}
+	return records
+}
+
+func TestServeData_StreamsFailures(t *testing.T) {
+	fakeUpstream(t)
+
+	records := postInfo(t, "Mynxee\nNobody\n")
+
+	if len(records) != 4 {
+		t.Fatalf("expected start, 2 results and done, got %v", records)
+	}
+	if records[0]["_meta"] != "start" || records[0]["total"] != 2.0 {
+		t.Fatalf("unexpected start record %v", records[0])
+	}
+
+	var gotChar, gotErr bool
+	for _, r := range records[1:3] {
+		switch r["_meta"] {
+		case nil:
+			gotChar = r["name"] == "Space Mom"
+		case "error":
+			gotErr = r["name"] == "Nobody" && r["kind"] == "not_found"
+		}
+	}
+	if !gotChar || !gotErr {
+		t.Fatalf("expected one character and one not_found error, got %v", records[1:3])
+	}
+
+	done := records[3]
+	if done["_meta"] != "done" || done["sent"] != 1.0 || done["failed"] != 1.0 {
+		t.Fatalf("unexpected done record %v", done)
+	}
+}
+
+func TestServeData_FleetPaste(t *testing.T) {
+	fakeUpstream(t)
+
+	records := postInfo(t, "Mynxee\tJita\tRifter\tFrigate\tFleet Commander\tFleet\n")
+
+	if len(records) != 3 || records[0]["format"] != "fleet" {
+		t.Fatalf("expected a fleet paste with one character, got %v", records)
+	}
+	fleet, _ := records[1]["fleet"].(map[string]any)
+	if fleet["ship"] != "Rifter" || fleet["system"] != "Jita" || fleet["role"] != "Fleet Commander" {
+		t.Fatalf("unexpected fleet fields %v", records[1])
+	}
+}
+
+func TestServeData_Truncated(t *testing.T) {
+	fakeUpstream(t)
+
+	form := url.Values{"characters": {"Mynxee\nNobody\nSomebody"}, "limit": {"1"}}
+	req := httptest.NewRequest(http.MethodPost, "/info", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	serveData(rec, req)
+
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(rec.Body.String()), "\n") {
+		var m map[string]any
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("bad record %q: %v", line, err)
+		}
+		records = append(records, m)
+	}
+
+	if len(records) != 5 || records[0]["total"] != 3.0 || records[0]["truncated"] != 2.0 {
+		t.Fatalf("expected 1 lookup and 2 truncated names, got %v", records)
+	}
+	truncated := 0
+	for _, r := range records[1:4] {
+		if r["_meta"] == "error" && r["kind"] == "truncated" {
+			truncated++
+		}
+	}
+	if truncated != 2 {
+		t.Fatalf("expected 2 truncated error records, got %v", records[1:4])
+	}
+	if done := records[4]; done["sent"] != 1.0 || done["failed"] != 2.0 {
+		t.Fatalf("unexpected done record %v", done)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ship classes, coarser than the inventory groups they are made of
+const (
+	classCapsule       = "capsule"
+	classShuttle       = "shuttle"
+	classFrigate       = "frigate"
+	classCovertOps     = "covert_ops"
+	classDestroyer     = "destroyer"
+	classCruiser       = "cruiser"
+	classBattlecruiser = "battlecruiser"
+	classBattleship    = "battleship"
+	classHauler        = "hauler"
+	classMining        = "mining"
+	classCapital       = "capital"
+	classStructure     = "structure"
+	classOther         = "other"
+	// types that couldn't be resolved
+	classUnknown = "unknown"
+)
+
+// ship groups by class, an extract of the static data. Groups not listed
+// fall back to the capital groups in typeinfo.go and then to classOther.
+var shipClassGroups = map[int]string{
+	groupCapsule: classCapsule,
+	31:           classShuttle,
+
+	25:   classFrigate, // Frigate
+	324:  classFrigate, // Assault Frigate
+	831:  classFrigate, // Interceptor
+	834:  classFrigate, // Stealth Bomber
+	893:  classFrigate, // Electronic Attack Ship
+	1022: classFrigate, // Prototype Exploration Ship
+	1527: classFrigate, // Logistics Frigate
+
+	groupCovertOps: classCovertOps,
+
+	420:  classDestroyer, // Destroyer
+	541:  classDestroyer, // Interdictor
+	1305: classDestroyer, // Tactical Destroyer
+	1534: classDestroyer, // Command Destroyer
+
+	26:   classCruiser, // Cruiser
+	358:  classCruiser, // Heavy Assault Cruiser
+	832:  classCruiser, // Logistics
+	833:  classCruiser, // Force Recon Ship
+	894:  classCruiser, // Heavy Interdiction Cruiser
+	906:  classCruiser, // Combat Recon Ship
+	963:  classCruiser, // Strategic Cruiser
+	1972: classCruiser, // Flag Cruiser
+
+	419:  classBattlecruiser, // Combat Battlecruiser
+	540:  classBattlecruiser, // Command Ship
+	1201: classBattlecruiser, // Attack Battlecruiser
+
+	27:  classBattleship, // Battleship
+	898: classBattleship, // Black Ops
+	900: classBattleship, // Marauder
+
+	28:   classHauler, // Hauler
+	380:  classHauler, // Deep Space Transport
+	513:  classHauler, // Freighter
+	902:  classHauler, // Jump Freighter
+	941:  classHauler, // Industrial Command Ship
+	1202: classHauler, // Blockade Runner
+
+	463:  classMining, // Mining Barge
+	543:  classMining, // Exhumer
+	1283: classMining, // Expedition Frigate
+}
+
+// exploration hulls that share their group with combat ships, covert ops
+// frigates are told by their group. They also stand in when the static data
+// can't be reached.
+var explorationTypes = map[int]bool{
+	586:   true, // Probe
+	605:   true, // Heron
+	607:   true, // Imicus
+	29248: true, // Magnate
+	33468: true, // Astero
+	33470: true, // Stratios
+}
+
+// shipClass places a resolved type in its class
+func shipClass(ti typeInfo) string {
+	if class, ok := shipClassGroups[ti.GroupID]; ok {
+		return class
+	}
+	switch {
+	case capitalGroups[ti.GroupID]:
+		return classCapital
+	case ti.CategoryID == categoryStructure || ti.CategoryID == categoryStarbase:
+		return classStructure
+	}
+	return classOther
+}
+
+// classifyShip resolves a type through fetchTypeInfo, which keeps it for
+// good, and returns its class. Types that can't be resolved, and killmails
+// without a ship, are classUnknown.
+func classifyShip(ctx context.Context, id int) string {
+	if id == 0 {
+		return classUnknown
+	}
+	ti, err := fetchTypeInfo(ctx, id)
+	if err != nil {
+		log.WithError(err).WithField("type", id).Debug("failed to classify ship")
+		return classUnknown
+	}
+	return shipClass(ti)
+}
+
+// isExplorerShip tells whether a hull of the given class is flown for
+// exploration
+func isExplorerShip(id int, class string) bool {
+	return explorationTypes[id] || class == classCovertOps
+}
+
+type classCount struct {
+	Class string `json:"class"`
+	Count int    `json:"count"`
+}
+
+// shipClassData breaks down a character's kills by the class of the ship
+// destroyed and their losses by the class of the ship lost, largest first
+type shipClassData struct {
+	Kills  []classCount `json:"kills"`
+	Losses []classCount `json:"losses"`
+}
+
+func sortedClasses(m map[string]int) []classCount {
+	counts := make([]classCount, 0, len(m))
+	for class, n := range m {
+		counts = append(counts, classCount{Class: class, Count: n})
+	}
+	slices.SortFunc(counts, func(a, b classCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Class, b.Class))
+	})
+	return counts
+}
+
+// newShipClassData returns nil when there is nothing to break down
+func newShipClassData(kills, losses map[string]int) *shipClassData {
+	if len(kills) == 0 && len(losses) == 0 {
+		return nil
+	}
+	return &shipClassData{Kills: sortedClasses(kills), Losses: sortedClasses(losses)}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cache "zgo.at/zcache/v2"
+)
+
+func TestShipClass(t *testing.T) {
+	tests := []struct {
+		name string
+		ti   typeInfo
+		want string
+	}{
+		{"capsule", typeInfo{GroupID: groupCapsule, CategoryID: categoryShip}, classCapsule},
+		{"covert ops", typeInfo{GroupID: 830, CategoryID: categoryShip}, classCovertOps},
+		{"stealth bomber", typeInfo{GroupID: 834, CategoryID: categoryShip}, classFrigate},
+		{"black ops", typeInfo{GroupID: 898, CategoryID: categoryShip}, classBattleship},
+		// freighters are haulers before capitals
+		{"freighter", typeInfo{GroupID: 513, CategoryID: categoryShip}, classHauler},
+		{"titan", typeInfo{GroupID: 30, CategoryID: categoryShip}, classCapital},
+		{"citadel", typeInfo{GroupID: 1657, CategoryID: categoryStructure}, classStructure},
+		{"control tower", typeInfo{GroupID: 365, CategoryID: categoryStarbase}, classStructure},
+		{"new group", typeInfo{GroupID: 99999, CategoryID: categoryShip}, classOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shipClass(tt.ti); got != tt.want {
+				t.Errorf("shipClass = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchKillHistory_ShipClasses(t *testing.T) {
+	ccpCache = cache.New[string, any](1*time.Hour, 10*time.Minute)
+	zkillCache = cache.New[string, any](1*time.Hour, 10*time.Minute)
+	killmailCache = cache.New[string, any](1*time.Hour, 10*time.Minute)
+
+	types := map[int]map[string]any{
+		// a covert ops frigate not in any list of explorer hulls
+		44996: {"name": "Pacifier", "group_id": 830},
+		587:   {"name": "Rifter", "group_id": 25},
+		648:   {"name": "Badger", "group_id": 28},
+	}
+	groups := map[int]map[string]any{
+		830: {"name": "Covert Ops", "category_id": 6},
+		25:  {"name": "Frigate", "category_id": 6},
+		28:  {"name": "Hauler", "category_id": 6},
+	}
+
+	var typeZero atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var id int
+		switch {
+		case r.URL.Path == "/kills/characterID/8/":
+			_ = json.NewEncoder(w).Encode([]zKillMail{
+				{ID: 1, Info: zKillMailInfo{Hash: "h1"}},
+				{ID: 2, Info: zKillMailInfo{Hash: "h2"}},
+				{ID: 3, Info: zKillMailInfo{Hash: "h3"}},
+				// ESI fails on this one
+				{ID: 5, Info: zKillMailInfo{Hash: "h5"}},
+			})
+		case r.URL.Path == "/killmails/5/h5/":
+			w.WriteHeader(http.StatusInternalServerError)
+		case r.URL.Path == "/universe/types/0/":
+			typeZero.Add(1)
+			w.WriteHeader(http.StatusNotFound)
+		case r.URL.Path == "/killmails/1/h1/":
+			_ = json.NewEncoder(w).Encode(killMail{Victim: zKillCharInfo{ShipTypeID: 44996}, Attackers: []zKillCharInfo{{CharacterID: 8}}})
+		case r.URL.Path == "/killmails/2/h2/":
+			_ = json.NewEncoder(w).Encode(killMail{Victim: zKillCharInfo{ShipTypeID: 587}, Attackers: []zKillCharInfo{{CharacterID: 8}}})
+		case r.URL.Path == "/killmails/3/h3/":
+			// a type the static data doesn't know
+			_ = json.NewEncoder(w).Encode(killMail{Victim: zKillCharInfo{ShipTypeID: 99999}, Attackers: []zKillCharInfo{{CharacterID: 8}}})
+		case r.URL.Path == "/losses/characterID/8/":
+			_ = json.NewEncoder(w).Encode([]zKillMail{{ID: 4, Info: zKillMailInfo{Hash: "h4"}}})
+		case r.URL.Path == "/killmails/4/h4/":
+			_ = json.NewEncoder(w).Encode(killMail{Victim: zKillCharInfo{CharacterID: 8, ShipTypeID: 648}})
+		case sscan(r.URL.Path, "/universe/types/%d/", &id) && types[id] != nil:
+			_ = json.NewEncoder(w).Encode(types[id])
+		case sscan(r.URL.Path, "/universe/groups/%d/", &id) && groups[id] != nil:
+			_ = json.NewEncoder(w).Encode(groups[id])
+		case r.URL.Path == "/universe/categories/6/":
+			_ = json.NewEncoder(w).Encode(map[string]any{"name": "Ship"})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+
+	origZkill := zkillAPIURL
+	origCcp := ccpEsiURL
+	zkillAPIURL = s.URL + "/"
+	ccpEsiURL = s.URL + "/"
+	defer func() { zkillAPIURL = origZkill; ccpEsiURL = origCcp }()
+
+	cd := analyzeKillmails(t, 8)
+	if cd.RecentExplorerTotal != 1 {
+		t.Errorf("explorer kills = %d, want 1", cd.RecentExplorerTotal)
+	}
+	if cd.ShipClasses == nil {
+		t.Fatal("expected ship classes")
+	}
+	// the failed killmail is left out, not counted as an unknown ship
+	wantKills := []classCount{{classCovertOps, 1}, {classFrigate, 1}, {classUnknown, 1}}
+	if !slices.Equal(cd.ShipClasses.Kills, wantKills) {
+		t.Errorf("kills = %+v, want %+v", cd.ShipClasses.Kills, wantKills)
+	}
+	wantLosses := []classCount{{classHauler, 1}}
+	if !slices.Equal(cd.ShipClasses.Losses, wantLosses) {
+		t.Errorf("losses = %+v, want %+v", cd.ShipClasses.Losses, wantLosses)
+	}
+
+	// killmails without a ship never ask ESI for type 0
+	if class := classifyShip(context.Background(), 0); class != classUnknown {
+		t.Errorf("class of type 0 = %s, want %s", class, classUnknown)
+	}
+	if n := typeZero.Load(); n != 0 {
+		t.Errorf("expected no lookups of type 0, got %d", n)
+	}
+}
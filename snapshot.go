@@ -0,0 +1,246 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	json "github.com/goccy/go-json"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	snapshotIDLength = 8
+	snapshotIDChars  = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+)
+
+var (
+	snapshotDir string
+	snapshotTTL time.Duration
+
+	// where saved lookups live, set up by setupSnapshots
+	snapshots snapshotStore
+)
+
+// snapshot is a saved lookup that can be shown again at /r/{id} without
+// fetching anything
+type snapshot struct {
+	ID         string           `json:"id"`
+	Created    time.Time        `json:"created"`
+	Expires    *time.Time       `json:"expires,omitempty"`
+	Characters []*characterData `json:"characters"`
+	Entities   []*entityData    `json:"entities,omitempty"`
+}
+
+func (s *snapshot) expired(now time.Time) bool {
+	return s.Expires != nil && now.After(*s.Expires)
+}
+
+type snapshotStore interface {
+	Save(s *snapshot) error
+	// Load returns an error matching errNotFound for unknown or expired ids
+	Load(id string) (*snapshot, error)
+	// Purge removes everything that has expired
+	Purge(now time.Time) error
+}
+
+// dirSnapshotStore keeps one JSON file per snapshot in a directory, so saved
+// lookups survive a restart
+type dirSnapshotStore struct {
+	dir string
+}
+
+func newDirSnapshotStore(dir string) (*dirSnapshotStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &dirSnapshotStore{dir: dir}, nil
+}
+
+func (d *dirSnapshotStore) path(id string) string {
+	return filepath.Join(d.dir, id+".json")
+}
+
+func (d *dirSnapshotStore) Save(s *snapshot) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	// write then rename so a reader never sees half a file
+	tmp, err := os.CreateTemp(d.dir, s.ID+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), d.path(s.ID))
+}
+
+func (d *dirSnapshotStore) Load(id string) (*snapshot, error) {
+	if !validSnapshotID(id) {
+		return nil, fmt.Errorf("snapshot %q %w", id, errNotFound)
+	}
+
+	data, err := os.ReadFile(d.path(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("snapshot %q %w", id, errNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var s snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	if s.expired(time.Now()) {
+		return nil, fmt.Errorf("snapshot %q %w", id, errNotFound)
+	}
+	return &s, nil
+}
+
+func (d *dirSnapshotStore) Purge(now time.Time) error {
+	files, err := filepath.Glob(filepath.Join(d.dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		var s snapshot
+		if err := json.Unmarshal(data, &s); err != nil || s.expired(now) {
+			if err := os.Remove(f); err != nil {
+				log.WithError(err).WithField("file", f).Warn("failed to remove snapshot")
+			}
+		}
+	}
+	return nil
+}
+
+func newSnapshotID() (string, error) {
+	b := make([]byte, snapshotIDLength)
+	base := big.NewInt(int64(len(snapshotIDChars)))
+	for i := range b {
+		n, err := rand.Int(rand.Reader, base)
+		if err != nil {
+			return "", err
+		}
+		b[i] = snapshotIDChars[n.Int64()]
+	}
+	return string(b), nil
+}
+
+func validSnapshotID(id string) bool {
+	if len(id) != snapshotIDLength {
+		return false
+	}
+	for _, c := range id {
+		if !strings.ContainsRune(snapshotIDChars, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// saveSnapshot stores the characters, corporations and alliances of a
+// completed lookup
+func saveSnapshot(chars []*characterData, entities []*entityData) (*snapshot, error) {
+	if snapshots == nil {
+		return nil, errors.New("snapshots are not enabled")
+	}
+
+	id, err := newSnapshotID()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &snapshot{ID: id, Created: time.Now().UTC(), Characters: chars, Entities: entities}
+	if snapshotTTL > 0 {
+		expires := s.Created.Add(snapshotTTL)
+		s.Expires = &expires
+	}
+
+	if err := snapshots.Save(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func setupSnapshots() {
+	store, err := newDirSnapshotStore(snapshotDir)
+	if err != nil {
+		log.WithError(err).Warn("snapshots disabled")
+		return
+	}
+	snapshots = store
+
+	go func() {
+		for range time.Tick(time.Hour) {
+			if err := snapshots.Purge(time.Now()); err != nil {
+				log.WithError(err).Warn("snapshot purge failed")
+			}
+		}
+	}()
+}
+
+// GET /r/{id}, the lookup page showing a saved snapshot
+func snapshotPageHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if snapshots == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	s, err := snapshots.Load(id)
+	if errors.Is(err, errNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.WithError(err).WithField("snapshot", id).Error("failed to load snapshot")
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	renderIndex(w, pageData{Snapshot: s})
+}
+
+// GET /api/v1/snapshots/{id}
+func apiSnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if snapshots == nil {
+		writeAPIError(w, http.StatusNotFound, "snapshots are not enabled")
+		return
+	}
+
+	s, err := snapshots.Load(id)
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			writeAPIError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		log.WithError(err).WithField("snapshot", id).Error("failed to load snapshot")
+		writeAPIError(w, http.StatusInternalServerError, "failed to load snapshot")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func useSnapshotStore(t *testing.T) *dirSnapshotStore {
+	t.Helper()
+
+	store, err := newDirSnapshotStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	orig := snapshots
+	snapshots = store
+	t.Cleanup(func() { snapshots = orig })
+	return store
+}
+
+func TestDirSnapshotStore(t *testing.T) {
+	store := useSnapshotStore(t)
+
+	past := time.Now().Add(-time.Minute)
+	live := &snapshot{ID: "abcdEFG1", Created: time.Now(), Characters: []*characterData{{Name: "Mynxee"}}}
+	old := &snapshot{ID: "abcdEFG2", Created: time.Now(), Expires: &past}
+
+	for _, s := range []*snapshot{live, old} {
+		if err := store.Save(s); err != nil {
+			t.Fatalf("save failed: %v", err)
+		}
+	}
+
+	got, err := store.Load(live.ID)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if len(got.Characters) != 1 || got.Characters[0].Name != "Mynxee" {
+		t.Fatalf("unexpected snapshot %+v", got)
+	}
+
+	for _, id := range []string{old.ID, "missing1", "../../etc", ""} {
+		if _, err := store.Load(id); !errors.Is(err, errNotFound) {
+			t.Fatalf("Load(%q) expected not found, got %v", id, err)
+		}
+	}
+
+	if err := store.Purge(time.Now()); err != nil {
+		t.Fatalf("purge failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(store.dir, old.ID+".json")); !os.IsNotExist(err) {
+		t.Fatalf("expected the expired snapshot to be purged")
+	}
+	if _, err := os.Stat(filepath.Join(store.dir, live.ID+".json")); err != nil {
+		t.Fatalf("expected the live snapshot to survive the purge: %v", err)
+	}
+}
+
+func TestNewSnapshotID(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		id, err := newSnapshotID()
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if !validSnapshotID(id) || seen[id] {
+			t.Fatalf("bad or repeated id %q", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestStreamLookup_SavesSnapshot(t *testing.T) {
+	fakeUpstream(t)
+	useSnapshotStore(t)
+
+	ctx := withSettings(context.Background(), lookupOptions{Save: true}.settings())
+
+	var done map[string]any
+	err := streamLookup(ctx, parsePaste("Mynxee\nNobody\nTestCorp", 10), func(event string, rec any) error {
+		if event == eventDone {
+			done = rec.(map[string]any)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	id, _ := done["snapshot"].(string)
+	if id == "" || done["url"] != "/r/"+id {
+		t.Fatalf("expected the done record to link the snapshot, got %v", done)
+	}
+
+	router := newRouter()
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/snapshots/"+id, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var snap snapshot
+	if err := json.Unmarshal(rec.Body.Bytes(), &snap); err != nil {
+		t.Fatalf("bad body: %v", err)
+	}
+	if len(snap.Characters) != 1 || snap.Characters[0].CharacterID != 123 {
+		t.Fatalf("unexpected snapshot %+v", snap)
+	}
+	if len(snap.Entities) != 1 || snap.Entities[0].Name != "TestCorp" {
+		t.Fatalf("expected the corporation to be saved, got %+v", snap.Entities)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/r/"+id, nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `data-snapshot="`+id+`"`) {
+		t.Fatalf("expected the page to reference the snapshot, got %d", rec.Code)
+	}
+
+	for _, path := range []string{"/r/zzzzzzzz", "/api/v1/snapshots/zzzzzzzz"} {
+		rec = httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("%s: expected 404, got %d", path, rec.Code)
+		}
+	}
+}
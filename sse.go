@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	json "github.com/goccy/go-json"
+	log "github.com/sirupsen/logrus"
+	cache "zgo.at/zcache/v2"
+)
+
+const (
+	sseHeartbeat = 15 * time.Second
+	// how long a lookup keeps running with nobody listening, so a dropped
+	// EventSource can reconnect and resume
+	sseResumeWindow = 30 * time.Second
+	// upper bound on a single lookup run by the event stream
+	sseLookupTimeout = 5 * time.Minute
+	sseRetryMillis   = 3000
+)
+
+// finished sessions stay around long enough for a late resume
+var sseSessions = cache.New[string, *sseSession](10*time.Minute, time.Minute)
+
+var (
+	// lookups the event stream runs at once, they outlive the request that
+	// started them so nothing else bounds them
+	maxSSESessions = 20
+	sseRunning     atomic.Int32
+)
+
+type sseEvent struct {
+	name string
+	data []byte
+}
+
+// sseSession is one lookup run for the event stream. It keeps every event so
+// a client can resume from its Last-Event-ID, and runs independently of any
+// single connection.
+type sseSession struct {
+	id     string
+	cancel context.CancelFunc
+
+	mu          sync.Mutex
+	events      []sseEvent
+	done        bool
+	updated     chan struct{} // closed and replaced whenever an event is added
+	subscribers int
+}
+
+// newSSESession starts the lookup of a session, nil when maxSSESessions are
+// running already
+func newSSESession(settings lookupSettings, p paste) *sseSession {
+	if sseRunning.Add(1) > int32(maxSSESessions) {
+		sseRunning.Add(-1)
+		return nil
+	}
+
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+
+	ctx, cancel := context.WithTimeout(withSettings(context.Background(), settings), sseLookupTimeout)
+	sess := &sseSession{
+		id:      hex.EncodeToString(b),
+		cancel:  cancel,
+		updated: make(chan struct{}),
+	}
+	sseSessions.Set(sess.id, sess)
+
+	go func() {
+		defer sseRunning.Add(-1)
+		defer cancel()
+		if err := streamLookup(ctx, p, sess.append); err != nil {
+			log.WithError(err).Warn("event stream lookup failed")
+		}
+		sess.mu.Lock()
+		sess.done = true
+		close(sess.updated)
+		sess.updated = make(chan struct{})
+		sess.mu.Unlock()
+	}()
+
+	return sess
+}
+
+func (s *sseSession) append(name string, rec any) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.events = append(s.events, sseEvent{name: name, data: data})
+	close(s.updated)
+	s.updated = make(chan struct{})
+	s.mu.Unlock()
+
+	return nil
+}
+
+// next returns the events after cursor, a channel that is closed when more
+// arrive and whether the lookup has finished
+func (s *sseSession) next(cursor int) ([]sseEvent, <-chan struct{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cursor > len(s.events) {
+		cursor = len(s.events)
+	}
+	return s.events[cursor:], s.updated, s.done
+}
+
+func (s *sseSession) subscribe() {
+	s.mu.Lock()
+	s.subscribers++
+	s.mu.Unlock()
+}
+
+// unsubscribe cancels an unfinished lookup once nobody has been listening for
+// sseResumeWindow
+func (s *sseSession) unsubscribe() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.subscribers--
+	if s.subscribers > 0 || s.done {
+		return
+	}
+
+	time.AfterFunc(sseResumeWindow, func() {
+		s.mu.Lock()
+		idle := s.subscribers == 0 && !s.done
+		s.mu.Unlock()
+		if idle {
+			s.cancel()
+		}
+	})
+}
+
+// parseLastEventID splits an event id of the form "session:sequence"
+func parseLastEventID(v string) (string, int, bool) {
+	sid, seq, ok := strings.Cut(v, ":")
+	if !ok || sid == "" {
+		return "", 0, false
+	}
+	n, err := strconv.Atoi(seq)
+	if err != nil || n < 0 {
+		return "", 0, false
+	}
+	return sid, n, true
+}
+
+// GET /info/events?lookup=..., the Server-Sent Events version of serveData.
+// Names are newline separated in the lookup parameter. A reconnecting
+// EventSource sends Last-Event-ID and picks up after the last event it saw.
+func serveEvents(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	var sess *sseSession
+	cursor := 0
+
+	if sid, seq, ok := parseLastEventID(r.Header.Get("Last-Event-ID")); ok {
+		if s, found := sseSessions.Get(sid); found {
+			sess, cursor = s, seq
+			log.WithFields(log.Fields{"session": sid, "after": seq}).Info("event stream resumed")
+		}
+	}
+
+	if sess == nil {
+		settings := optionsFromForm(r).settings()
+		p := parsePaste(strings.Join(r.URL.Query()["lookup"], "\n"), settings.maxNames)
+		if len(p.jobs) == 0 {
+			http.Error(w, "no names given", http.StatusBadRequest)
+			return
+		}
+		if sess = newSSESession(settings, p); sess == nil {
+			w.Header().Set("Retry-After", strconv.Itoa(int(sseResumeWindow.Seconds())))
+			http.Error(w, "too many lookups running, try again later", http.StatusServiceUnavailable)
+			return
+		}
+		log.WithFields(log.Fields{"count": len(p.jobs), "format": p.format}).Info("event stream started")
+	}
+
+	// a 204 stops an EventSource from reconnecting once it has seen everything
+	if events, _, done := sess.next(cursor); done && len(events) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	sess.subscribe()
+	defer sess.unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", sseRetryMillis); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		events, updated, done := sess.next(cursor)
+
+		for _, ev := range events {
+			cursor++
+			if _, err := fmt.Fprintf(w, "id: %s:%d\nevent: %s\ndata: %s\n\n", sess.id, cursor, ev.name, ev.data); err != nil {
+				log.Warn("client disconnected")
+				return
+			}
+		}
+		flusher.Flush()
+
+		// done is read together with the events, so everything has been sent
+		if done {
+			return
+		}
+
+		select {
+		case <-updated:
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
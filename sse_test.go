@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type testEvent struct {
+	id, name, data string
+}
+
+// readEvents reads a text/event-stream body until it ends
+func readEvents(t *testing.T, resp *http.Response) []testEvent {
+	t.Helper()
+	defer resp.Body.Close()
+
+	var events []testEvent
+	var ev testEvent
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "":
+			if ev.name != "" {
+				events = append(events, ev)
+			}
+			ev = testEvent{}
+		case strings.HasPrefix(line, "id: "):
+			ev.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			ev.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			ev.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	return events
+}
+
+func TestServeEvents_StreamAndResume(t *testing.T) {
+	fakeUpstream(t)
+	s := httptest.NewServer(newRouter())
+	defer s.Close()
+
+	u := s.URL + "/info/events?" + url.Values{"lookup": {"Mynxee\nNobody"}}.Encode()
+
+	resp, err := http.Get(u)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	events := readEvents(t, resp)
+	counts := map[string]int{}
+	for _, ev := range events {
+		counts[ev.name]++
+	}
+	if counts["start"] != 1 || counts["character"] != 1 || counts["error"] != 1 || counts["done"] != 1 {
+		t.Fatalf("unexpected events %v", events)
+	}
+	if events[0].name != "start" || events[len(events)-1].name != "done" {
+		t.Fatalf("expected start first and done last, got %v", events)
+	}
+
+	// resume after the first event and expect everything else again
+	req, _ := http.NewRequest(http.MethodGet, u, nil)
+	req.Header.Set("Last-Event-ID", events[0].id)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+
+	resumed := readEvents(t, resp)
+	if len(resumed) != len(events)-1 {
+		t.Fatalf("expected %d events after resume, got %v", len(events)-1, resumed)
+	}
+	for i, ev := range resumed {
+		if ev != events[i+1] {
+			t.Fatalf("resumed event %d = %v; want %v", i, ev, events[i+1])
+		}
+	}
+
+	// nothing left after the done event
+	req.Header.Set("Last-Event-ID", events[len(events)-1].id)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("final resume failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 once everything was sent, got %d", resp.StatusCode)
+	}
+}
+
+func TestServeEvents_NoNames(t *testing.T) {
+	rec := httptest.NewRecorder()
+	serveEvents(rec, httptest.NewRequest(http.MethodGet, "/info/events?lookup=", nil))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+}
+
+func TestServeEvents_Limit(t *testing.T) {
+	defer func(n int) { maxSSESessions = n }(maxSSESessions)
+	maxSSESessions = 0
+
+	rec := httptest.NewRecorder()
+	serveEvents(rec, httptest.NewRequest(http.MethodGet, "/info/events?lookup=Mynxee", nil))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatal("expected a Retry-After header")
+	}
+	if n := sseRunning.Load(); n != 0 {
+		t.Fatalf("rejected session left %d running", n)
+	}
+}
+
+func TestParseLastEventID(t *testing.T) {
+	cases := []struct {
+		in     string
+		sid    string
+		seq    int
+		wantOK bool
+	}{
+		{"abc:3", "abc", 3, true},
+		{"abc:x", "", 0, false},
+		{":3", "", 0, false},
+		{"abc", "", 0, false},
+		{"abc:-1", "", 0, false},
+	}
+
+	for _, tc := range cases {
+		sid, seq, ok := parseLastEventID(tc.in)
+		if ok != tc.wantOK || sid != tc.sid || seq != tc.seq {
+			t.Fatalf("parseLastEventID(%q) = %q, %d, %v", tc.in, sid, seq, ok)
+		}
+	}
+}
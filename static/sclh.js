@@ -24,12 +24,24 @@ function activatePasteHintOnce() {
 const dataFormatting = (function () {
   return {
     char_name: function (data, type, row) {
+      let name = escapeHtml(row.name);
       if (row.has_killboard) {
         const url = `${zkill_server}/character/${row.character_id}`;
-        return `<a href="${url}" target="_blank" rel="noopener">${escapeHtml(row.name)}</a>`;
-      } else {
-        return data;
+        name = `<a href="${url}" target="_blank" rel="noopener">${name}</a>`;
+      }
+      if (row.fleet) {
+        name += formatFleet(row.fleet);
+      }
+      if (row.kill) {
+        name += formatKillRole(row.kill);
       }
+      if (row.cyno_pilot) {
+        name += '<br><small class="cyno">cyno pilot</small>';
+      }
+      if (row.cloaky_hunter) {
+        name += '<br><small class="cyno">cloaky hunter</small>';
+      }
+      return name;
     },
     corp_name: function (data, type, row) {
       const url = `${zkill_server}/corporation/${row.corp_id}`;
@@ -53,6 +65,16 @@ const dataFormatting = (function () {
         return '';
       }
     },
+    threat: function (data, type, row) {
+      if (!data) return type === 'sort' ? -1 : '';
+      if (type !== 'display') return data.score;
+      const why = data.factors
+        .filter((f) => f.points > 0)
+        .slice(0, 3)
+        .map((f) => f.reason)
+        .join(', ');
+      return `<span title="${escapeHtml(why)}">${data.score}</span>`;
+    },
     alliance_name: function (data, type, row) {
       const url = `${zkill_server}/alliance/${row.alliance_id}`;
       return `<a href="${url}" target="_blank" rel="noopener">${escapeHtml(row.alliance_name)}</a>`;
@@ -66,12 +88,16 @@ const dataFormatting = (function () {
       return groupRow(corp_name, alliance, corp_id, corp_danger, npc_corp);
     },
     postProcess: function (row, data, dataIndex) {
-      if (data.danger > 50) {
+      const threat = data.threat ? data.threat.level : data.danger > 50 ? 'high' : 'low';
+      if (threat === 'high') {
         $('td:eq(1)', row).addClass('danger_thumb');
-        $('td:eq(4)', row).addClass('danger');
+        $('td:eq(15)', row).addClass('danger');
       } else {
         $('td:eq(1)', row).addClass('thumb');
       }
+      if (data.danger > 50) {
+        $('td:eq(4)', row).addClass('danger');
+      }
       if (data.security < 0) {
         $('td:eq(6)', row).addClass('danger');
       }
@@ -82,7 +108,7 @@ const dataFormatting = (function () {
       } else {
         $('td:eq(9)', row).addClass('blank_thumb');
       }
-      if (!data.analyze_kills || data.kills == 0) {
+      if (!data.threat && (!data.analyze_kills || data.kills == 0)) {
         $('td:eq(0)', row).addClass('blank-control');
       } else {
         $('td:eq(0)', row).addClass('details-control');
@@ -95,17 +121,25 @@ async function postNames(names) {
   $('html').addClass('wait');
   table.clear().draw(false);
 
-  const response = await fetch('info', {
+  const save = document.getElementById('save-snapshot');
+  const params = { characters: names };
+  if (save && save.checked) params.save = 'true';
+  showShareLink(null);
+  enableExport(names);
+  clearEntities();
+
+  const response = await fetch('/info', {
     method: 'POST',
     headers: {
       'Content-Type': 'application/x-www-form-urlencoded',
     },
-    body: new URLSearchParams({ characters: names }),
+    body: new URLSearchParams(params),
   });
 
   const reader = response.body.getReader();
   const decoder = new TextDecoder();
   let buffer = '';
+  const failures = [];
 
   try {
     while (true) {
@@ -125,16 +159,25 @@ async function postNames(names) {
         if (msg._meta) {
           if (msg._meta === 'start') {
             setTableBusy(true);
-            updateStatus(`Loading ${msg.total} characters`);
+            updateStatus(`Loading ${msg.total} characters${formatPaste(msg)}`);
           }
 
           if (msg._meta === 'progress') {
-            updateStatus(`Loaded ${msg.sent} of ${msg.total} characters`);
+            updateStatus(`Loaded ${msg.sent} of ${msg.total} characters${formatPhase(msg)}`);
+          }
+
+          if (msg._meta === 'error') {
+            failures.push(msg);
+          }
+
+          if (msg._meta === 'corporation' || msg._meta === 'alliance') {
+            addEntity(msg);
           }
 
           if (msg._meta === 'done') {
             setTableBusy(false);
-            updateStatus(`Finished loading ${msg.sent} characters`);
+            updateStatus(`Finished loading ${msg.sent} characters${formatFailures(failures)}`);
+            showShareLink(msg.url);
           }
 
           continue;
@@ -151,6 +194,145 @@ async function postNames(names) {
   }
 }
 
+const phaseNames = {
+  ids: 'resolving names',
+  ccp: 'character records',
+  zkill: 'zKillboard stats',
+  kills: 'kill analysis',
+};
+
+const pasteFormats = {
+  chat: 'a chat log',
+  fleet: 'the fleet window',
+  links: 'links',
+  tabbed: 'a tab separated copy',
+};
+
+function formatPaste(msg) {
+  let text = pasteFormats[msg.format] ? ` from ${pasteFormats[msg.format]}` : '';
+  const skipped = msg.unparsed || [];
+  if (skipped.length > 0) {
+    text += `, ${skipped.length} line${skipped.length === 1 ? '' : 's'} skipped`;
+    console.info('skipped lines', skipped);
+  }
+  if (msg.truncated > 0) {
+    text += `, ${msg.truncated} over the limit and left out`;
+  }
+  return text;
+}
+
+function formatFleet(fleet) {
+  const parts = [fleet.ship, fleet.system, fleet.position || fleet.role].filter(Boolean);
+  return `<br><small class="fleet">${escapeHtml(parts.join(' · '))}</small>`;
+}
+
+const killRoles = {
+  victim: 'victim',
+  attacker: 'attacker',
+  final_blow: 'final blow',
+};
+
+function formatKillRole(kill) {
+  const url = `${zkill_server}/kill/${kill.killmail_id}/`;
+  const role = escapeHtml(killRoles[kill.role] || kill.role);
+  return `<br><small class="kill">${role} on <a href="${url}" target="_blank" rel="noopener">kill ${kill.killmail_id}</a></small>`;
+}
+
+// pasted corporations and alliances are listed above the character table
+function clearEntities() {
+  const list = document.getElementById('entities');
+  if (!list) return;
+  list.replaceChildren();
+  list.hidden = true;
+}
+
+function addEntity(entity) {
+  const list = document.getElementById('entities');
+  if (!list) return;
+  const url = `${zkill_server}/${entity._meta}/${entity.id}/`;
+  const parts = [
+    `${entity.member_count} members`,
+    `danger ${entity.danger}%`,
+    entity.alliance_name ? escapeHtml(entity.alliance_name) : '',
+  ].filter(Boolean);
+  const item = document.createElement('li');
+  item.innerHTML =
+    `${escapeHtml(entity._meta)} <a href="${url}" target="_blank" rel="noopener">` +
+    `[${escapeHtml(entity.ticker)}] ${escapeHtml(entity.name)}</a>: ${parts.join(', ')}`;
+  list.append(item);
+  list.hidden = false;
+}
+
+function formatPhase(msg) {
+  const phase = msg.phases && msg.phases[msg.phase];
+  if (!phase) return '';
+  return `, ${phaseNames[msg.phase] || msg.phase} ${phase.done} of ${phase.total}`;
+}
+
+function formatFailures(failures) {
+  // names past the limit are counted, listing them all would swamp the status
+  const truncated = failures.filter((f) => f.kind === 'truncated').length;
+  const failed = failures.filter((f) => f.kind !== 'truncated');
+  let text = '';
+  if (failed.length > 0) {
+    const reasons = { not_found: 'not found', upstream: 'lookup failed', timeout: 'timed out' };
+    const list = failed
+      .map((f) => `${f.name} (${reasons[f.kind] || f.kind}${formatSuggestions(f.suggestions)})`)
+      .join(', ');
+    text += `, ${failed.length} failed: ${list}`;
+  }
+  if (truncated > 0) {
+    text += `, ${truncated} left out over the limit`;
+  }
+  return text;
+}
+
+function formatSuggestions(suggestions) {
+  if (!suggestions || suggestions.length === 0) return '';
+  return `, did you mean ${suggestions.map((s) => s.name).join(' or ')}?`;
+}
+
+function showShareLink(url) {
+  const share = document.getElementById('share-link');
+  if (!share) return;
+  if (!url) {
+    share.hidden = true;
+    return;
+  }
+  const link = share.querySelector('a');
+  link.href = url;
+  link.textContent = new URL(url, window.location.href).href;
+  share.hidden = false;
+}
+
+// the export form looks the same names up again, mostly from cache
+function enableExport(names) {
+  const characters = document.getElementById('export-characters');
+  if (!characters) return;
+  characters.value = names;
+  characters.form.action = '/export';
+  document.getElementById('export-button').disabled = false;
+}
+
+async function loadSnapshot(id) {
+  setTableBusy(true);
+  try {
+    const response = await fetch(`/api/v1/snapshots/${encodeURIComponent(id)}`);
+    if (!response.ok) {
+      updateStatus('Snapshot not found');
+      return;
+    }
+    const snap = await response.json();
+    table.rows.add(snap.characters).draw(false);
+    (snap.entities || []).forEach(addEntity);
+    updateStatus(`Showing ${snap.characters.length} characters from a snapshot`);
+  } catch (err) {
+    console.error('snapshot error', err);
+  } finally {
+    setTableBusy(false);
+  }
+}
+
 function sendNames() {
   const names = document.getElementById('name-list').value;
   postNames(names);
@@ -214,9 +396,180 @@ function handlePaste(e) {
   if (pastedData) postNames(pastedData);
 }
 
+function formatHunterExample(ex) {
+  if (!ex) return '';
+  const url = `${zkill_server}/kill/${ex.killmail_id}/`;
+  return `<a href="${url}" target="_blank" rel="noopener">${escapeHtml(ex.source)} ${escapeHtml(ex.date.slice(0, 10))}</a>`;
+}
+
+const associateKinds = [
+  ['characters', 'Pilot', 'character'],
+  ['corporations', 'Corporation', 'corporation'],
+  ['alliances', 'Alliance', 'alliance'],
+];
+
+// who the character flies with, linked to their zKillboard pages
+function formatAssociates(d) {
+  const a = d.associates;
+  if (!a) return '';
+  const rows = associateKinds
+    .flatMap(([key, label, page]) =>
+      a[key].map((as) => {
+        const url = `${zkill_server}/${page}/${as.id}/`;
+        const name = escapeHtml(as.name || String(as.id));
+        return `<tr>
+                <td>${label}</td>
+                <td><a href="${url}" target="_blank" rel="noopener">${name}</a></td>
+                <td class="dt-body-center">${as.count}</td>
+                <td class="dt-body-center">${escapeHtml(as.last_seen.slice(0, 10))}</td>
+              </tr>`;
+      }),
+    )
+    .join('');
+  return `<table class="embedded">
+            <thead><tr>
+              <td>Associate</td>
+              <td></td>
+              <td>Kills Together</td>
+              <td class="dt-body-center">Last Seen</td>
+            </tr></thead>
+            <tbody>${rows}</tbody>
+          </table>`;
+}
+
+// kills and losses by ship class, like "frigate 3, covert ops 1"
+function formatClassCounts(counts) {
+  return counts.map((c) => `${escapeHtml(c.class.replace('_', ' '))} ${c.count}`).join(', ');
+}
+
+function formatShipClasses(d) {
+  const sc = d.ship_classes;
+  if (!sc) return '';
+  return `<table class="embedded">
+            <tbody>
+              <tr><td>Killed</td><td>${formatClassCounts(sc.kills)}</td></tr>
+              <tr><td>Lost</td><td>${formatClassCounts(sc.losses)}</td></tr>
+            </tbody>
+          </table>`;
+}
+
+// where the character is seen, top systems and regions and the kinds of space
+function formatLocations(d) {
+  const l = d.locations;
+  if (!l) return '';
+  const systems = l.systems
+    .map(
+      (s) => `<tr>
+                <td>${escapeHtml(s.name)} (${s.security.toFixed(1)})</td>
+                <td>${escapeHtml(s.region)}</td>
+                <td class="dt-body-center">${s.count}</td>
+              </tr>`,
+    )
+    .join('');
+  const regions = l.regions.map((r) => `${escapeHtml(r.name)} (${r.count})`).join(', ');
+  const space = `high ${l.space.high_sec}%, low ${l.space.low_sec}%, null ${l.space.null_sec}%, wormhole ${l.space.wormhole}%`;
+  return `<table class="embedded">
+            <thead><tr>
+              <td>System</td>
+              <td>Region</td>
+              <td>Killmails</td>
+            </tr></thead>
+            <tbody>${systems}</tbody>
+            <tfoot>
+              <tr><td colspan="3">Regions: ${regions}</td></tr>
+              <tr><td colspan="3">Space: ${space} of ${l.samples} killmails</td></tr>
+            </tfoot>
+          </table>`;
+}
+
+const weekdays = ['Sun', 'Mon', 'Tue', 'Wed', 'Thu', 'Fri', 'Sat'];
+
+// when the character is seen on killmails, darker cells for busier hours
+function formatActivity(d) {
+  const a = d.activity;
+  if (!a) return '';
+  const busiest = Math.max(...a.heatmap.flat());
+  const hours = [...Array(24).keys()].map((h) => `<td>${h}</td>`).join('');
+  const rows = a.heatmap
+    .map((day, i) => {
+      const cells = day
+        .map((n) => {
+          const alpha = n ? (0.2 + (0.8 * n) / busiest).toFixed(2) : 0;
+          return `<td style="background-color: rgba(255, 0, 0, ${alpha})" title="${n}"></td>`;
+        })
+        .join('');
+      return `<tr><td>${weekdays[i]}</td>${cells}</tr>`;
+    })
+    .join('');
+  const tz = a.timezone
+    ? `${escapeHtml(a.timezone)} (${Math.round(a.confidence * 100)}% confidence)`
+    : 'unknown';
+  return `<table class="embedded heatmap">
+            <thead>
+              <tr><td colspan="25">Activity (EVE time) from ${a.samples} killmails, timezone ${tz}</td></tr>
+              <tr><td></td>${hours}</tr>
+            </thead>
+            <tbody>${rows}</tbody>
+          </table>`;
+}
+
+const cynoSigns = {
+  cyno: 'cyno',
+  covert_cyno: 'covert cyno',
+  industrial_cyno: 'industrial cyno',
+  force_recon: 'force recon',
+  black_ops: 'black ops',
+};
+
+// the losses that gave a cyno pilot away
+function formatCyno(d) {
+  if (!d.cyno_evidence) return '';
+  const rows = d.cyno_evidence
+    .map((e) => {
+      const url = `${zkill_server}/kill/${e.killmail_id}/`;
+      const signs = e.signs.map((s) => cynoSigns[s] || s).join(', ');
+      return `<tr>
+                <td><a href="${url}" target="_blank" rel="noopener">${e.killmail_id}</a></td>
+                <td class="dt-body-center">${escapeHtml(e.date.slice(0, 10))}</td>
+                <td>${escapeHtml(signs)}</td>
+              </tr>`;
+    })
+    .join('');
+  return `<table class="embedded">
+            <thead><tr>
+              <td>Cyno Loss</td>
+              <td class="dt-body-center">Date</td>
+              <td>Fitted</td>
+            </tr></thead>
+            <tbody>${rows}</tbody>
+          </table>`;
+}
+
+// the threat breakdown, every factor with what it added to the score
+function formatThreat(d) {
+  if (!d.threat) return '';
+  const rows = d.threat.factors
+    .map(
+      (f) => `<tr>
+                <td>${escapeHtml(f.reason)}</td>
+                <td class="dt-body-center">${f.weight}</td>
+                <td class="dt-body-center">${f.points.toFixed(1)}</td>
+              </tr>`,
+    )
+    .join('');
+  return `<table class="embedded">
+            <thead><tr>
+              <td>Threat ${d.threat.score} (${escapeHtml(d.threat.level)})</td>
+              <td>Weight</td>
+              <td>Points</td>
+            </tr></thead>
+            <tbody>${rows}</tbody>
+          </table>`;
+}
+
 function formatKills(d) {
   // `d` is the original data object for the row
-  if (d.kills === 0) {
+  if (!d.analyze_kills || d.kills === 0) {
     return '';
   } else {
     return `<table class="embedded">
@@ -225,6 +578,8 @@ function formatKills(d) {
               <td>Total Killed</td>
               <td class="dt-body-center">Since</td>
               <td>Kills in Last Week</td>
+              <td>Covert Kills</td>
+              <td>Hunter Example</td>
             </tr></thead>
             <tbody>
               <tr>
@@ -232,6 +587,8 @@ function formatKills(d) {
                 <td class="dt-body-center">${d.recent_kill_total}</td>
                 <td class="dt-body-center">${escapeHtml(d.last_kill_time)}</td>
                 <td class="dt-body-center">${d.kills_last_week}</td>
+                <td class="dt-body-center">${d.covert_kill_share || 0}%</td>
+                <td class="dt-body-center">${formatHunterExample(d.hunter_example)}</td>
               </tr>
             </tbody>
           </table>`;
@@ -266,6 +623,7 @@ $(document).ready(function () {
       { data: 'alliance_name', render: dataFormatting.alliance_name },
       { data: 'last_kill', orderable: false },
       { data: 'corp_age', render: dataFormatting.corp_age, orderable: false },
+      { data: 'threat', render: dataFormatting.threat, className: 'dt-body-center', defaultContent: '' },
       { data: 'corp_id', visible: false },
       { data: 'corp_danger', visible: false },
       { data: 'is_npc_corp', visible: false },
@@ -286,6 +644,9 @@ $(document).ready(function () {
   toggleCorpGrouping();
   document.getElementById('chars').addEventListener('paste', handlePaste);
 
+  const snapshotId = document.getElementById('the-body').dataset.snapshot;
+  if (snapshotId) loadSnapshot(snapshotId);
+
   // Textarea removed — paste anywhere is handled by the global handler
 
   // Global paste handler: submit pasted text as names unless paste is into an editable field
@@ -339,7 +700,18 @@ $(document).ready(function () {
       if (row.child() && row.child().length) {
         row.child.show();
       } else {
-        row.child(formatKills(row.data())).show();
+        const d = row.data();
+        row
+          .child(
+            formatKills(d) +
+              formatShipClasses(d) +
+              formatActivity(d) +
+              formatLocations(d) +
+              formatAssociates(d) +
+              formatCyno(d) +
+              formatThreat(d),
+          )
+          .show();
       }
       tr.addClass('shown');
     }
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// suggestions returned by /api/v1/suggest unless asked for fewer
+	defaultSuggestions = 10
+	maxSuggestions     = 50
+	// suggestions attached to a not found error record
+	errorSuggestions = 3
+)
+
+// suggestion is a known name close to what was asked for
+type suggestion struct {
+	Name string `json:"name"`
+	ID   int    `json:"id"`
+	// character, corporation or alliance
+	Kind string `json:"kind"`
+}
+
+// nameIndex holds every character, corporation and alliance name resolved
+// since the server started, keyed by the lower case name. It is fed by
+// cacheIDs, so it grows alongside the name entries of ccpCache.
+type nameIndex struct {
+	mu      sync.RWMutex
+	entries map[string]suggestion
+}
+
+var knownNames = newNameIndex()
+
+func newNameIndex() *nameIndex {
+	return &nameIndex{entries: make(map[string]suggestion)}
+}
+
+func (x *nameIndex) add(kind string, entry idEntry) {
+	if entry.Name == "" {
+		return
+	}
+	x.mu.Lock()
+	x.entries[strings.ToLower(entry.Name)] = suggestion{Name: entry.Name, ID: entry.ID, Kind: kind}
+	x.mu.Unlock()
+}
+
+// suggest returns up to limit names that start with q, shortest first,
+// followed by names within a few typos of it, closest first. Case is ignored.
+func (x *nameIndex) suggest(q string, limit int) []suggestion {
+	q = strings.ToLower(strings.TrimSpace(q))
+	if q == "" || limit < 1 {
+		return nil
+	}
+
+	// one typo for short names, about one in four characters for longer ones
+	maxDistance := max(1, len(q)/4)
+
+	type match struct {
+		suggestion
+		key      string
+		prefix   bool
+		distance int
+	}
+
+	x.mu.RLock()
+	var matches []match
+	for key, s := range x.entries {
+		if strings.HasPrefix(key, q) {
+			matches = append(matches, match{s, key, true, len(key) - len(q)})
+			continue
+		}
+		if abs(len(key)-len(q)) > maxDistance {
+			continue
+		}
+		if d := editDistance(key, q); d <= maxDistance {
+			matches = append(matches, match{s, key, false, d})
+		}
+	}
+	x.mu.RUnlock()
+
+	slices.SortFunc(matches, func(a, b match) int {
+		if a.prefix != b.prefix {
+			if a.prefix {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Or(cmp.Compare(a.distance, b.distance), cmp.Compare(a.key, b.key))
+	})
+
+	out := make([]suggestion, 0, min(limit, len(matches)))
+	for _, m := range matches[:min(limit, len(matches))] {
+		out = append(out, m.suggestion)
+	}
+	return out
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// editDistance is the Levenshtein distance between a and b, counted in bytes
+// as EVE names are ASCII
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(min(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(b)]
+}
+
+// GET /api/v1/suggest?q=...&limit=..., known names starting with or close
+// to q
+func apiSuggestHandler(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.FormValue("q"))
+	if q == "" {
+		writeAPIError(w, http.StatusBadRequest, "q is required")
+		return
+	}
+
+	limit := defaultSuggestions
+	if n, err := strconv.Atoi(r.FormValue("limit")); err == nil && n > 0 {
+		limit = min(n, maxSuggestions)
+	}
+
+	writeJSON(w, http.StatusOK, knownNames.suggest(q, limit))
+}
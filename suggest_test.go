@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"mynxee", "mynxee", 0},
+		{"mynxee", "mynxe", 1},
+		{"mynxee", "mnyxee", 2},
+		{"portia tigana", "portia tigena", 1},
+		{"", "abc", 3},
+	}
+
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestNameIndex_Suggest(t *testing.T) {
+	x := newNameIndex()
+	x.add(entityCharacter, idEntry{ID: 1, Name: "Mynxee"})
+	x.add(entityCharacter, idEntry{ID: 2, Name: "Mynxee Junior"})
+	x.add(entityCharacter, idEntry{ID: 3, Name: "Minxee"})
+	x.add(entityCorporation, idEntry{ID: 4, Name: "Signal Cartel"})
+
+	names := func(s []suggestion) []string {
+		out := make([]string, 0, len(s))
+		for _, v := range s {
+			out = append(out, v.Name)
+		}
+		return out
+	}
+
+	// prefix matches first, shortest first, then typos
+	got := names(x.suggest("MYNX", 10))
+	if len(got) != 2 || got[0] != "Mynxee" || got[1] != "Mynxee Junior" {
+		t.Fatalf("unexpected prefix suggestions %q", got)
+	}
+	got = names(x.suggest("mynxee", 10))
+	if len(got) != 3 || got[0] != "Mynxee" || got[1] != "Mynxee Junior" || got[2] != "Minxee" {
+		t.Fatalf("unexpected typo suggestions %q", got)
+	}
+	if s := x.suggest("signal cartell", 1); len(s) != 1 || s[0] != (suggestion{Name: "Signal Cartel", ID: 4, Kind: entityCorporation}) {
+		t.Fatalf("unexpected corporation suggestion %+v", s)
+	}
+	if s := x.suggest("Nobody", 10); len(s) != 0 {
+		t.Fatalf("expected no suggestions, got %+v", s)
+	}
+}
+
+func TestServeData_NotFoundSuggestions(t *testing.T) {
+	fakeUpstream(t)
+
+	// the first lookup puts Mynxee in the index
+	postInfo(t, "Mynxee")
+	records := postInfo(t, "Mynxe")
+
+	if len(records) != 3 || records[1]["_meta"] != "error" {
+		t.Fatalf("expected one error record, got %v", records)
+	}
+	s, _ := records[1]["suggestions"].([]any)
+	if len(s) != 1 || s[0].(map[string]any)["name"] != "Mynxee" {
+		t.Fatalf("expected Mynxee to be suggested, got %v", records[1])
+	}
+}
+
+func TestAPISuggest(t *testing.T) {
+	fakeUpstream(t)
+	knownNames.add(entityAlliance, idEntry{ID: 789, Name: "Test Alliance"})
+
+	rec := httptest.NewRecorder()
+	newRouter().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/suggest?q=test&limit=1", nil))
+
+	var got []suggestion
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("unexpected response %d %s", rec.Code, rec.Body.String())
+	}
+	if len(got) != 1 || got[0].Kind != entityAlliance {
+		t.Fatalf("unexpected suggestions %+v", got)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// threat levels, by score out of 100
+const (
+	threatHigh   = 50
+	threatMedium = 25
+)
+
+// threatScore rates how dangerous a character is from 0 to 100, Factors say
+// what the score is made of, the largest share first
+type threatScore struct {
+	Score   int                  `json:"score"`
+	Level   string               `json:"level"`
+	Factors []threatContribution `json:"factors"`
+}
+
+// threatContribution is one factor of a threat score. Value is how strongly
+// the factor applies from 0 to 1, Points is what it adds to the score.
+type threatContribution struct {
+	Factor string  `json:"factor"`
+	Weight float64 `json:"weight"`
+	Value  float64 `json:"value"`
+	Points float64 `json:"points"`
+	Reason string  `json:"reason"`
+}
+
+// threatFactor scores one thing about a character, ok is false when the
+// character record doesn't have what the factor needs. Such factors are left
+// out of the score rather than counted as harmless.
+type threatFactor struct {
+	name  string
+	value func(cd *characterData) (v float64, reason string, ok bool)
+}
+
+// threatWeights are how much each factor counts, relative to each other.
+// -threat-weights changes them.
+var threatWeights = map[string]float64{
+	"danger":          30,
+	"kills_last_week": 20,
+	"corp_danger":     15,
+	"security":        15,
+	"age":             10,
+	"gang":            5,
+	"npc_corp":        5,
+}
+
+// kills in the kill window that count as fully active, and the age below
+// which a character counts as new
+const (
+	threatBusyKills = 20
+	threatNewDays   = 365
+)
+
+var threatFactors = []threatFactor{
+	{"danger", func(cd *characterData) (float64, string, bool) {
+		return float64(cd.Danger) / 100, fmt.Sprintf("danger ratio %d%%", cd.Danger), true
+	}},
+	{"kills_last_week", func(cd *characterData) (float64, string, bool) {
+		// only counted by the kill analysis
+		if !cd.AnalyzeKills || cd.Kills == 0 {
+			return 0, "", false
+		}
+		v := float64(min(cd.KillsLastWeek, threatBusyKills)) / threatBusyKills
+		return v, fmt.Sprintf("%d recent kills", cd.KillsLastWeek), true
+	}},
+	{"corp_danger", func(cd *characterData) (float64, string, bool) {
+		return float64(cd.CorpDanger) / 100, fmt.Sprintf("corporation danger ratio %d%%", cd.CorpDanger), true
+	}},
+	{"security", func(cd *characterData) (float64, string, bool) {
+		// -5 and below is as bad as it gets, anything positive is harmless
+		v := math.Max(0, math.Min(1, float64(-cd.Security)/5))
+		return v, fmt.Sprintf("security status %.1f", cd.Security), true
+	}},
+	{"age", func(cd *characterData) (float64, string, bool) {
+		// new characters are often throwaway scouts and cyno alts
+		born, err := time.Parse(time.RFC3339, cd.Birthday)
+		if err != nil {
+			return 0, "", false
+		}
+		days := int(time.Since(born).Hours() / 24)
+		v := 1 - float64(min(max(days, 0), threatNewDays))/threatNewDays
+		return v, fmt.Sprintf("created %d days ago", days), true
+	}},
+	{"gang", func(cd *characterData) (float64, string, bool) {
+		return float64(cd.Gang) / 100, fmt.Sprintf("flies with others on %d%% of kills", cd.Gang), true
+	}},
+	{"npc_corp", func(cd *characterData) (float64, string, bool) {
+		if cd.IsNpcCorp {
+			return 1, "in an NPC corporation", true
+		}
+		return 0, "in a player corporation", true
+	}},
+}
+
+// setThreatWeights reads -threat-weights, a list like "danger=40,gang=0".
+// Factors not named keep their weight.
+func setThreatWeights(spec string) error {
+	for _, part := range strings.Split(spec, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return fmt.Errorf("%q is not factor=weight", part)
+		}
+		if _, known := threatWeights[name]; !known {
+			return fmt.Errorf("unknown threat factor %q", name)
+		}
+		w, err := strconv.ParseFloat(value, 64)
+		if err != nil || w < 0 {
+			return fmt.Errorf("invalid weight %q for %s", value, name)
+		}
+		threatWeights[name] = w
+	}
+	return nil
+}
+
+// computeThreat scores a character from the fields fetchDetails gathered
+func computeThreat(cd *characterData) *threatScore {
+	factors := make([]threatContribution, 0, len(threatFactors))
+	total := 0.0
+	for _, f := range threatFactors {
+		w := threatWeights[f.name]
+		v, reason, ok := f.value(cd)
+		if !ok || w == 0 {
+			continue
+		}
+		total += w
+		factors = append(factors, threatContribution{Factor: f.name, Weight: w, Value: round2(v), Reason: reason})
+	}
+
+	ts := &threatScore{Factors: factors}
+	if total == 0 {
+		ts.Level = threatLevel(0)
+		return ts
+	}
+
+	score := 0.0
+	for i := range factors {
+		points := factors[i].Weight * factors[i].Value / total * 100
+		factors[i].Points = round2(points)
+		score += points
+	}
+	slices.SortStableFunc(factors, func(a, b threatContribution) int {
+		return cmp.Compare(b.Points, a.Points)
+	})
+
+	ts.Score = int(math.Round(score))
+	ts.Level = threatLevel(ts.Score)
+	return ts
+}
+
+func threatLevel(score int) string {
+	switch {
+	case score >= threatHigh:
+		return "high"
+	case score >= threatMedium:
+		return "medium"
+	}
+	return "low"
+}
+
+func round2(f float64) float64 {
+	return math.Round(f*100) / 100
+}
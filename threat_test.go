@@ -0,0 +1,93 @@
+package main
+
+import (
+	"maps"
+	"testing"
+	"time"
+)
+
+func TestComputeThreat(t *testing.T) {
+	newbie := time.Now().AddDate(0, 0, -10).UTC().Format(time.RFC3339)
+
+	tests := []struct {
+		name      string
+		cd        characterData
+		wantLevel string
+		wantTop   string
+		wantSkip  string
+	}{
+		{
+			name:      "old carebear",
+			cd:        characterData{Danger: 0, Security: 5, Birthday: "2005-01-01T00:00:00Z"},
+			wantLevel: "low",
+			wantSkip:  "kills_last_week",
+		},
+		{
+			name: "active pirate",
+			cd: characterData{
+				Danger: 95, Gang: 20, Security: -10, CorpDanger: 90, Kills: 500,
+				AnalyzeKills: true, KillsLastWeek: 40, Birthday: "2010-01-01T00:00:00Z",
+			},
+			wantLevel: "high",
+			wantTop:   "danger",
+		},
+		{
+			name:      "fresh alt",
+			cd:        characterData{IsNpcCorp: true, Birthday: newbie},
+			wantLevel: "low",
+			wantTop:   "age",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := computeThreat(&tt.cd)
+			if ts.Level != tt.wantLevel {
+				t.Errorf("level = %q (score %d), want %q", ts.Level, ts.Score, tt.wantLevel)
+			}
+			if tt.wantTop != "" && ts.Factors[0].Factor != tt.wantTop {
+				t.Errorf("top factor = %+v, want %s", ts.Factors[0], tt.wantTop)
+			}
+
+			points := 0.0
+			for _, f := range ts.Factors {
+				points += f.Points
+				if f.Factor == tt.wantSkip {
+					t.Errorf("expected %s to be left out, got %+v", tt.wantSkip, f)
+				}
+				if f.Reason == "" {
+					t.Errorf("factor %s has no reason", f.Factor)
+				}
+			}
+			if diff := points - float64(ts.Score); diff > 1 || diff < -1 {
+				t.Errorf("factors add up to %.2f, score is %d", points, ts.Score)
+			}
+		})
+	}
+}
+
+func TestSetThreatWeights(t *testing.T) {
+	orig := maps.Clone(threatWeights)
+	t.Cleanup(func() { threatWeights = orig })
+
+	if err := setThreatWeights("danger=100, gang=0"); err != nil {
+		t.Fatal(err)
+	}
+	if threatWeights["danger"] != 100 || threatWeights["gang"] != 0 || threatWeights["age"] != orig["age"] {
+		t.Fatalf("unexpected weights %v", threatWeights)
+	}
+
+	// only danger counts now, and a zero weight drops the factor
+	ts := computeThreat(&characterData{Danger: 60, Gang: 100, Security: 5, Birthday: "2005-01-01T00:00:00Z"})
+	for _, f := range ts.Factors {
+		if f.Factor == "gang" {
+			t.Fatalf("expected gang to be dropped, got %+v", ts.Factors)
+		}
+	}
+
+	for _, bad := range []string{"danger", "speed=10", "danger=-1", "danger=lots"} {
+		if err := setThreatWeights(bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	json "github.com/goccy/go-json"
+	cache "zgo.at/zcache/v2"
+)
+
+// typeInfo is an inventory type with its group and category, what d-scan
+// and killmail analysis need to tell a Rifter from a Titan
+type typeInfo struct {
+	ID           int    `json:"type_id"`
+	Name         string `json:"name"`
+	GroupID      int    `json:"group_id"`
+	GroupName    string `json:"group_name"`
+	CategoryID   int    `json:"category_id"`
+	CategoryName string `json:"category_name"`
+}
+
+// inventory categories and groups the analysis cares about
+const (
+	categoryCelestial  = 2
+	categoryShip       = 6
+	categoryCharge     = 8
+	categoryDrone      = 18
+	categoryDeployable = 22
+	categoryStarbase   = 23
+	categoryStructure  = 65
+	categoryFighter    = 87
+
+	groupCapsule             = 29
+	groupCovertOps           = 830
+	groupMobileWarpDisruptor = 361
+	groupInterdictionProbe   = 548
+)
+
+// capital hulls by group
+var capitalGroups = map[int]bool{
+	30:   true, // Titan
+	485:  true, // Dreadnought
+	513:  true, // Freighter
+	547:  true, // Carrier
+	659:  true, // Supercarrier
+	883:  true, // Capital Industrial Ship
+	902:  true, // Jump Freighter
+	1538: true, // Force Auxiliary
+	4594: true, // Lancer Dreadnought
+}
+
+// fetchTypeInfo resolves a type, its group and its category. The static data
+// never changes while the server runs so every part is cached for good.
+func fetchTypeInfo(ctx context.Context, id int) (typeInfo, error) {
+	key := fmt.Sprint("typeinfo:", id)
+	if rec, found := ccpCache.Get(key); found {
+		return rec.(typeInfo), nil
+	}
+
+	var t struct {
+		Name    string `json:"name"`
+		GroupID int    `json:"group_id"`
+	}
+	if err := ccpGetStatic(ctx, fmt.Sprintf("universe/types/%d/", id), &t); err != nil {
+		return typeInfo{}, err
+	}
+
+	group, err := fetchGroupInfo(ctx, t.GroupID)
+	if err != nil {
+		return typeInfo{}, err
+	}
+
+	ti := typeInfo{
+		ID:           id,
+		Name:         t.Name,
+		GroupID:      t.GroupID,
+		GroupName:    group.Name,
+		CategoryID:   group.CategoryID,
+		CategoryName: group.CategoryName,
+	}
+
+	ccpCache.SetWithExpire(key, ti, cache.NoExpiration)
+	// fetchItemName can use it too
+	ccpCache.SetWithExpire(fmt.Sprint("ship:", id), ti.Name, cache.NoExpiration)
+
+	return ti, nil
+}
+
+type groupInfo struct {
+	Name         string
+	CategoryID   int
+	CategoryName string
+}
+
+func fetchGroupInfo(ctx context.Context, id int) (groupInfo, error) {
+	key := fmt.Sprint("group:", id)
+	if rec, found := ccpCache.Get(key); found {
+		return rec.(groupInfo), nil
+	}
+
+	var g struct {
+		Name       string `json:"name"`
+		CategoryID int    `json:"category_id"`
+	}
+	if err := ccpGetStatic(ctx, fmt.Sprintf("universe/groups/%d/", id), &g); err != nil {
+		return groupInfo{}, err
+	}
+
+	catKey := fmt.Sprint("category:", g.CategoryID)
+	catName, found := ccpCache.Get(catKey)
+	if !found {
+		var c struct {
+			Name string `json:"name"`
+		}
+		if err := ccpGetStatic(ctx, fmt.Sprintf("universe/categories/%d/", g.CategoryID), &c); err != nil {
+			return groupInfo{}, err
+		}
+		catName = c.Name
+		ccpCache.SetWithExpire(catKey, catName, cache.NoExpiration)
+	}
+
+	gi := groupInfo{Name: g.Name, CategoryID: g.CategoryID, CategoryName: catName.(string)}
+	ccpCache.SetWithExpire(key, gi, cache.NoExpiration)
+
+	return gi, nil
+}
+
+// ccpGetStatic fetches a piece of the static data in English
+func ccpGetStatic(ctx context.Context, url string, v any) error {
+	jsonPayload, err := ccpGet(ctx, url, map[string]string{"datasource": "tranquility", "language": "en"})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(jsonPayload, v)
+}